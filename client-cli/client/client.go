@@ -1,9 +1,11 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 )
 
@@ -21,9 +23,24 @@ func postWrapper(url string, body string) (string, error) {
 	return string(content), nil
 }
 
+// postJSON is like postWrapper, but marshals the body. This is required when
+// values (such as transformer content) may themselves contain quotes
+func postJSON(url string, body map[string]interface{}) (string, error) {
+	text, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	return postWrapper(url, string(text))
+}
+
+// New returns a client of the server at REDPANDA_URL, if it is set
 func New() Client {
 	var client Client
 	client.URL = "http://localhost:8080/api"
+	if url := os.Getenv("REDPANDA_URL"); url != "" {
+		client.URL = strings.TrimSuffix(url, "/") + "/api"
+	}
 
 	return client
 }
@@ -37,8 +54,25 @@ func (c *Client) StepInitialize() (string, error) {
 	return result, err
 }
 
-func (c *Client) StepIdempotentApply(transactionName string) (string, error) {
-	result, err := postWrapper(c.URL+"/step/idempotent-apply", fmt.Sprintf("{\"transaction\": \"%s\"}", transactionName))
+// StepIdempotentApply applies the transformers of a transaction. If verify is true,
+// they are run a second time, and the ones that change anything are reported. If
+// continueOnError is true, repositories that fail do not stop the others
+func (c *Client) StepIdempotentApply(transactionName string, verify bool, continueOnError bool) (string, error) {
+	result, err := postJSON(c.URL+"/action/apply", map[string]interface{}{
+		"transaction":     transactionName,
+		"verify":          verify,
+		"continueOnError": continueOnError,
+	})
+	return result, err
+}
+
+// StepSummary applies the transformers of a transaction, and returns a summary of
+// the result as a table, JSON, or Markdown
+func (c *Client) StepSummary(transactionName string, format string) (string, error) {
+	result, err := postJSON(c.URL+"/action/summary", map[string]interface{}{
+		"transaction": transactionName,
+		"format":      format,
+	})
 	return result, err
 }
 
@@ -47,8 +81,14 @@ func (c *Client) StepDiff(transactionName string) (string, error) {
 	return result, err
 }
 
-func (c *Client) TransformerAdd(transactionName string, typ string, transformer string, content string) (string, error) {
-	result, err := postWrapper(c.URL+"/transformer/add", fmt.Sprintf("{\"transaction\": \"%s\", \"type\": \"%s\", \"transformer\": \"%s\", \"content\": \"%s\"}", transactionName, typ, transformer, content))
+func (c *Client) TransformerAdd(transactionName string, typ string, transformer string, content string, template bool) (string, error) {
+	result, err := postJSON(c.URL+"/transformer/add", map[string]interface{}{
+		"transaction": transactionName,
+		"type":        typ,
+		"transformer": transformer,
+		"content":     content,
+		"template":    template,
+	})
 	return result, err
 }
 
@@ -57,18 +97,61 @@ func (c *Client) TransformerRemove(transactionName string, transformer string) (
 	return result, err
 }
 
-func (c *Client) TransformerEdit(transactionName string, transformer string, newContent string) (string, error) {
-	result, err := postWrapper(c.URL+"/transformer/edit", fmt.Sprintf("{\"transaction\": \"%s\", \"transformer\": \"%s\", \"newContent\": \"%s\"}", transactionName, transformer, newContent))
+// TransformerEdit changes the content of a transformer. If template is nil, whether
+// the content is a template is left unchanged
+func (c *Client) TransformerEdit(transactionName string, transformer string, newContent string, template *bool) (string, error) {
+	body := map[string]interface{}{
+		"transaction": transactionName,
+		"transformer": transformer,
+		"newContent":  newContent,
+	}
+	if template != nil {
+		body["template"] = *template
+	}
+
+	result, err := postJSON(c.URL+"/transformer/edit", body)
+	return result, err
+}
+
+func (c *Client) TransformerScope(transactionName string, transformer string, include []string, exclude []string, repos []string, tags []string) (string, error) {
+	result, err := postJSON(c.URL+"/transformer/scope", map[string]interface{}{
+		"transaction": transactionName,
+		"transformer": transformer,
+		"include":     include,
+		"exclude":     exclude,
+		"repos":       repos,
+		"tags":        tags,
+	})
+	return result, err
+}
+
+func (c *Client) TransformerOrder(transactionName string, order []string) (string, error) {
+	result, err := postJSON(c.URL+"/transformer/order", map[string]interface{}{
+		"transaction": transactionName,
+		"order":       order,
+	})
 	return result, err
 }
 
-func (c *Client) TransformerOrder(transactionName string, order string) (string, error) {
-	result, err := postWrapper(c.URL+"/transformer/order", fmt.Sprintf("{\"transaction\": \"%s\", \"order\": \"%s\"}", transactionName, order))
+func (c *Client) TransformerMove(transactionName string, transformer string, before string, after string) (string, error) {
+	result, err := postJSON(c.URL+"/transformer/move", map[string]interface{}{
+		"transaction": transactionName,
+		"transformer": transformer,
+		"before":      before,
+		"after":       after,
+	})
 	return result, err
 }
 
-func (c *Client) RepoAdd(transaction string, repo string) (string, error) {
-	result, err := postWrapper(c.URL+"/repo/add", fmt.Sprintf("{\"transaction\": \"%s\", \"repo\": \"%s\"}", transaction, repo))
+// RepoAdd adds a repository to a transaction. It is cloned from url if it is set,
+// and otherwise from the host with a name of host (by default, GitHub)
+func (c *Client) RepoAdd(transaction string, repo string, url string, host string) (string, error) {
+	result, err := postJSON(c.URL+"/repo/add", map[string]interface{}{
+		"transaction": transaction,
+		"repo":        repo,
+		"url":         url,
+		"host":        host,
+	})
 	return result, err
 }
 
@@ -77,6 +160,24 @@ func (c *Client) RepoRemove(transaction string, repo string) (string, error) {
 	return result, err
 }
 
+func (c *Client) RepoTags(transaction string, repo string, tags []string) (string, error) {
+	result, err := postJSON(c.URL+"/repo/tags", map[string]interface{}{
+		"transaction": transaction,
+		"repo":        repo,
+		"tags":        tags,
+	})
+	return result, err
+}
+
+func (c *Client) RepoVariables(transaction string, repo string, variables map[string]string) (string, error) {
+	result, err := postJSON(c.URL+"/repo/variables", map[string]interface{}{
+		"transaction": transaction,
+		"repo":        repo,
+		"variables":   variables,
+	})
+	return result, err
+}
+
 func (c *Client) TransactionGet(name string) (string, error) {
 	result, err := postWrapper(c.URL+"/transaction/get", fmt.Sprintf("{ \"name\": \"%s\" }", name))
 	if err != nil {
@@ -101,7 +202,46 @@ func (c *Client) TransactionRename(oldName string, newName string) error {
 	return err
 }
 
+// TransactionIdentity sets who the commits of a transaction are made by, and how
+// they are signed. Empty values are taken from the configuration of the server
+func (c *Client) TransactionIdentity(name string, commitName string, email string, signing string, signingKey string) (string, error) {
+	result, err := postJSON(c.URL+"/transaction/identity", map[string]interface{}{
+		"name":       name,
+		"commitName": commitName,
+		"email":      email,
+		"signing":    signing,
+		"signingKey": signingKey,
+	})
+	return result, err
+}
+
 func (c *Client) TransactionList() (string, error) {
 	result, err := postWrapper(c.URL+"/transaction/list", "{}")
 	return result, err
 }
+
+func (c *Client) HostList() (string, error) {
+	result, err := postWrapper(c.URL+"/host/list", "{}")
+	return result, err
+}
+
+// HostSet adds a git host that repositories can be cloned from, or replaces the
+// host with the same name
+func (c *Client) HostSet(name string, domain string, protocol string, user string, port int, credentialHelper string) (string, error) {
+	result, err := postJSON(c.URL+"/host/set", map[string]interface{}{
+		"name":             name,
+		"domain":           domain,
+		"protocol":         protocol,
+		"user":             user,
+		"port":             port,
+		"credentialHelper": credentialHelper,
+	})
+	return result, err
+}
+
+func (c *Client) HostRemove(name string) (string, error) {
+	result, err := postJSON(c.URL+"/host/remove", map[string]interface{}{
+		"name": name,
+	})
+	return result, err
+}
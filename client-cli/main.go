@@ -1,14 +1,23 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/hyperupcall/redpanda/client-cli/client"
 	cli "github.com/urfave/cli/v2"
 )
 
+// Types that are not built in are run by a plugin named redpanda-transformer-<type>
+var pluginTypeRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var transformerTypes = []string{"command", "regex", "replace", "comby", "go-rewrite", "structured-edit", "starlark", "file-write", "file-delete", "file-move", "patch", "dependency", "header"}
+
 func main() {
 	client := client.New()
 
@@ -43,10 +52,58 @@ func main() {
 					{
 						Name:  "idempotent-apply",
 						Usage: "Idempotently apply transformations",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "verify",
+								Usage: "Run transformers a second time, and report the ones that change anything",
+							},
+							&cli.BoolFlag{
+								Name:  "continue-on-error",
+								Usage: "Keep going when a repository fails, and report the outcome of each one",
+							},
+							&cli.BoolFlag{
+								Name:  "raw",
+								Usage: "Print the combined unified diff of every repository, rather than the JSON result",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							transaction := ctx.Args().First()
+
+							result, err := client.StepIdempotentApply(transaction, ctx.Bool("verify"), ctx.Bool("continue-on-error"))
+							if err != nil {
+								return err
+							}
+
+							if ctx.Bool("raw") {
+								result, err = rawDiff(result)
+								if err != nil {
+									return err
+								}
+							}
+							fmt.Println(result)
+
+							return nil
+						},
+					},
+					{
+						Name:  "summary",
+						Usage: "Apply transformations, and summarize what changed in each repository",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "format",
+								Usage: "Format of the summary (table, json, markdown)",
+								Value: "table",
+							},
+						},
 						Action: func(ctx *cli.Context) error {
 							transaction := ctx.Args().First()
 
-							result, err := client.StepIdempotentApply(transaction)
+							format := ctx.String("format")
+							if format != "table" && format != "json" && format != "markdown" {
+								return fmt.Errorf("Format must be one of table, json, markdown")
+							}
+
+							result, err := client.StepSummary(transaction, format)
 							if err != nil {
 								return err
 							}
@@ -91,7 +148,7 @@ func main() {
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:     "type",
-								Usage:    "Type of transformer (command,regex)",
+								Usage:    "Type of transformer (" + strings.Join(transformerTypes, ",") + ", or the type of a plugin)",
 								Required: true,
 							},
 							&cli.StringFlag{
@@ -99,18 +156,23 @@ func main() {
 								Usage:    "Content of transformer",
 								Required: true,
 							},
+							&cli.BoolFlag{
+								Name:  "template",
+								Usage: "Render content as a Go text/template for each repository",
+							},
 						},
 						Action: func(ctx *cli.Context) error {
 							transformer := ctx.Args().First()
 							transaction := ctx.String("transaction")
 							typ := ctx.String("type")
 							content := ctx.String("content")
+							template := ctx.Bool("template")
 
-							if typ != "command" && typ != "regex" {
-								return fmt.Errorf("Type must be either command or regex")
+							if !isTransformerType(typ) && !pluginTypeRegex.MatchString(typ) {
+								return fmt.Errorf("Type must be one of %s, or the type of a plugin", strings.Join(transformerTypes, ", "))
 							}
 
-							result, err := client.TransformerAdd(transaction, typ, transformer, content)
+							result, err := client.TransformerAdd(transaction, typ, transformer, content, template)
 							if err != nil {
 								return err
 							}
@@ -146,13 +208,23 @@ func main() {
 								Usage:    "Content of transformer",
 								Required: true,
 							},
+							&cli.BoolFlag{
+								Name:  "template",
+								Usage: "Render content as a Go text/template for each repository",
+							},
 						},
 						Action: func(ctx *cli.Context) error {
 							transformer := ctx.Args().First()
 							transaction := ctx.String("transaction")
 							newContent := ctx.String("content")
 
-							result, err := client.TransformerEdit(transaction, transformer, newContent)
+							var template *bool
+							if ctx.IsSet("template") {
+								value := ctx.Bool("template")
+								template = &value
+							}
+
+							result, err := client.TransformerEdit(transaction, transformer, newContent, template)
 							if err != nil {
 								return err
 							}
@@ -163,10 +235,47 @@ func main() {
 						},
 					},
 					{
-						Name:  "order",
-						Usage: "order transformers (TODO)",
+						Name:      "scope",
+						Usage:     "limit the files and repositories a transformer applies to",
+						ArgsUsage: "<transformer>",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "include",
+								Usage: "Glob of files the transformer may change",
+							},
+							&cli.StringSliceFlag{
+								Name:  "exclude",
+								Usage: "Glob of files the transformer may not change",
+							},
+							&cli.StringSliceFlag{
+								Name:  "repo",
+								Usage: "Glob of repository names the transformer runs in",
+							},
+							&cli.StringSliceFlag{
+								Name:  "tag",
+								Usage: "Tag of repositories the transformer runs in",
+							},
+						},
 						Action: func(ctx *cli.Context) error {
-							order := ctx.Args().First()
+							transformer := ctx.Args().First()
+							transaction := ctx.String("transaction")
+
+							result, err := client.TransformerScope(transaction, transformer, ctx.StringSlice("include"), ctx.StringSlice("exclude"), ctx.StringSlice("repo"), ctx.StringSlice("tag"))
+							if err != nil {
+								return err
+							}
+
+							fmt.Println(result)
+
+							return nil
+						},
+					},
+					{
+						Name:      "order",
+						Usage:     "set the order of all transformers",
+						ArgsUsage: "<transformer>...",
+						Action: func(ctx *cli.Context) error {
+							order := ctx.Args().Slice()
 							transaction := ctx.String("transaction")
 
 							result, err := client.TransformerOrder(transaction, order)
@@ -176,6 +285,40 @@ func main() {
 
 							fmt.Println(result)
 
+							return nil
+						},
+					},
+					{
+						Name:      "move",
+						Usage:     "move a transformer before or after another",
+						ArgsUsage: "<transformer>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "before",
+								Usage: "Name of the transformer to move before",
+							},
+							&cli.StringFlag{
+								Name:  "after",
+								Usage: "Name of the transformer to move after",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							transformer := ctx.Args().First()
+							transaction := ctx.String("transaction")
+							before := ctx.String("before")
+							after := ctx.String("after")
+
+							if (before == "") == (after == "") {
+								return fmt.Errorf("Exactly one of --before or --after must be specified")
+							}
+
+							result, err := client.TransformerMove(transaction, transformer, before, after)
+							if err != nil {
+								return err
+							}
+
+							fmt.Println(result)
+
 							return nil
 						},
 					},
@@ -194,13 +337,79 @@ func main() {
 				},
 				Subcommands: []*cli.Command{
 					{
-						Name:  "add",
-						Usage: "Add repository to the transaction",
+						Name:      "add",
+						Usage:     "Add repository to the transaction",
+						ArgsUsage: "<repo>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "url",
+								Usage: "URL or local path to clone the repository from",
+							},
+							&cli.StringFlag{
+								Name:  "host",
+								Usage: "Name of the host to clone the repository from (default: github)",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							repo := ctx.Args().First()
+							transaction := ctx.String("transaction")
+
+							// Relative paths are relative to where the command is run, not
+							// where the server runs
+							url := ctx.String("url")
+							if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+								abs, err := filepath.Abs(url)
+								if err != nil {
+									return err
+								}
+								url = abs
+							}
+
+							result, err := client.RepoAdd(transaction, repo, url, ctx.String("host"))
+							if err != nil {
+								return err
+							}
+							fmt.Println(result)
+
+							return nil
+						},
+					},
+					{
+						Name:      "tags",
+						Usage:     "Set the tags of a repository",
+						ArgsUsage: "<repo> <tag>...",
+						Action: func(ctx *cli.Context) error {
+							repo := ctx.Args().First()
+							tags := ctx.Args().Tail()
+							transaction := ctx.String("transaction")
+
+							result, err := client.RepoTags(transaction, repo, tags)
+							if err != nil {
+								return err
+							}
+							fmt.Println(result)
+
+							return nil
+						},
+					},
+					{
+						Name:      "vars",
+						Usage:     "Set the template variables of a repository",
+						ArgsUsage: "<repo> <key=value>...",
 						Action: func(ctx *cli.Context) error {
 							repo := ctx.Args().First()
 							transaction := ctx.String("transaction")
 
-							result, err := client.RepoAdd(transaction, repo)
+							variables := map[string]string{}
+							for _, arg := range ctx.Args().Tail() {
+								key, value, found := strings.Cut(arg, "=")
+								if !found {
+									return fmt.Errorf("Variable must be of the form key=value: %s", arg)
+								}
+								variables[key] = value
+							}
+
+							result, err := client.RepoVariables(transaction, repo, variables)
 							if err != nil {
 								return err
 							}
@@ -288,6 +497,41 @@ func main() {
 							return nil
 						},
 					},
+					{
+						Name:      "identity",
+						Usage:     "set who the commits of a transaction are made by, and how they are signed",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "commit-name",
+								Usage: "Name of the author and committer",
+							},
+							&cli.StringFlag{
+								Name:  "email",
+								Usage: "Email of the author and committer",
+							},
+							&cli.StringFlag{
+								Name:  "signing",
+								Usage: "How commits are signed (gpg, ssh, none)",
+							},
+							&cli.StringFlag{
+								Name:  "signing-key",
+								Usage: "GPG key ID, or SSH key, that commits are signed with",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							name := ctx.Args().First()
+
+							result, err := client.TransactionIdentity(name, ctx.String("commit-name"), ctx.String("email"), ctx.String("signing"), ctx.String("signing-key"))
+							if err != nil {
+								return err
+							}
+
+							fmt.Println(result)
+
+							return nil
+						},
+					},
 					{
 						Name:  "list",
 						Usage: "list a transaction",
@@ -299,6 +543,84 @@ func main() {
 
 							fmt.Println(result)
 
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "host",
+				Usage: "Manage the git hosts that repositories are cloned from",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list hosts, including the default ones",
+						Action: func(ctx *cli.Context) error {
+							result, err := client.HostList()
+							if err != nil {
+								return err
+							}
+
+							fmt.Println(result)
+
+							return nil
+						},
+					},
+					{
+						Name:      "set",
+						Usage:     "add a host, or replace the one with the same name",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "domain",
+								Usage:    "Domain of the host (ex. gitlab.example.com)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "protocol",
+								Usage: "Protocol to clone with (ssh, https)",
+								Value: "ssh",
+							},
+							&cli.StringFlag{
+								Name:  "user",
+								Usage: "User to clone as, over SSH (default: git)",
+							},
+							&cli.IntFlag{
+								Name:  "port",
+								Usage: "Port of the host, if not the default of the protocol",
+							},
+							&cli.StringFlag{
+								Name:  "credential-helper",
+								Usage: "Git credential helper to use over HTTPS",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							name := ctx.Args().First()
+
+							result, err := client.HostSet(name, ctx.String("domain"), ctx.String("protocol"), ctx.String("user"), ctx.Int("port"), ctx.String("credential-helper"))
+							if err != nil {
+								return err
+							}
+
+							fmt.Println(result)
+
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "remove a host",
+						ArgsUsage: "<name>",
+						Action: func(ctx *cli.Context) error {
+							name := ctx.Args().First()
+
+							result, err := client.HostRemove(name)
+							if err != nil {
+								return err
+							}
+
+							fmt.Println(result)
+
 							return nil
 						},
 					},
@@ -312,3 +634,30 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// rawDiff extracts the unified diff from the result of applying a transaction
+func rawDiff(result string) (string, error) {
+	var data struct {
+		Contents string `json:"contents"`
+		Error    string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(result), &data); err != nil {
+		return "", err
+	}
+
+	if data.Error != "" {
+		return "", fmt.Errorf("%s", data.Error)
+	}
+
+	return data.Contents, nil
+}
+
+func isTransformerType(typ string) bool {
+	for _, t := range transformerTypes {
+		if t == typ {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// Config is where the server keeps its data, and how it runs. Paths that are not
+// set are derived from ConfigDir and DataDir, which follow the XDG base directory
+// specification. Running several servers, each with a different DataDir and
+// Address, keeps them isolated from each other
+type Config struct {
+	ConfigDir   string `toml:"-"`
+	DataDir     string `toml:"data_dir"`
+	DataFile    string `toml:"data_file"`
+	DownloadDir string `toml:"download_dir"`
+	LedgerDir   string `toml:"ledger_dir"`
+	LedgerURL   string `toml:"ledger_url"`
+	PluginDir   string `toml:"plugin_dir"`
+	LogFile     string `toml:"log_file"`
+	Address     string `toml:"address"`
+	Workers     int    `toml:"workers"`
+
+	// The commit identity of every transaction, unless a transaction has its own
+	CommitName  string `toml:"commit_name"`
+	CommitEmail string `toml:"commit_email"`
+	Signing     string `toml:"signing"`
+	SigningKey  string `toml:"signing_key"`
+}
+
+const (
+	defaultLedgerURL = "git@github.com:hyperupcall/transactions"
+	defaultAddress   = ":3000"
+
+	// Most of the work is done by git subprocesses (and the network), so this is
+	// independent of the number of CPUs
+	defaultWorkers = 8
+)
+
+// setting is a configurable value, by the name of its flag and environment variable
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value func(c *Config) *string
+}
+
+var settings = []setting{
+	{"config-dir", "REDPANDA_CONFIG_DIR", "Directory of the configuration file and of the data file", func(c *Config) *string { return &c.ConfigDir }},
+	{"data-dir", "REDPANDA_DATA_DIR", "Directory of downloaded repositories, the transaction repository, and plugins", func(c *Config) *string { return &c.DataDir }},
+	{"data-file", "REDPANDA_DATA_FILE", "File that transactions are saved to", func(c *Config) *string { return &c.DataFile }},
+	{"download-dir", "REDPANDA_DOWNLOAD_DIR", "Directory that repositories are cloned to", func(c *Config) *string { return &c.DownloadDir }},
+	{"ledger-dir", "REDPANDA_LEDGER_DIR", "Directory of the transaction repository, which records committed transactions", func(c *Config) *string { return &c.LedgerDir }},
+	{"ledger-url", "REDPANDA_LEDGER_URL", "URL that the transaction repository is cloned from", func(c *Config) *string { return &c.LedgerURL }},
+	{"plugin-dir", "REDPANDA_PLUGIN_DIR", "Directory of transformer plugins", func(c *Config) *string { return &c.PluginDir }},
+	{"log-file", "REDPANDA_LOG_FILE", "File to log to", func(c *Config) *string { return &c.LogFile }},
+	{"address", "REDPANDA_ADDRESS", "Address to listen on", func(c *Config) *string { return &c.Address }},
+	{"commit-name", "REDPANDA_COMMIT_NAME", "Name of the author and committer of commits", func(c *Config) *string { return &c.CommitName }},
+	{"commit-email", "REDPANDA_COMMIT_EMAIL", "Email of the author and committer of commits", func(c *Config) *string { return &c.CommitEmail }},
+	{"signing", "REDPANDA_SIGNING", "How commits are signed (gpg, ssh, none)", func(c *Config) *string { return &c.Signing }},
+	{"signing-key", "REDPANDA_SIGNING_KEY", "Key that commits are signed with", func(c *Config) *string { return &c.SigningKey }},
+}
+
+// xdgDir returns the directory of redpanda within an XDG base directory
+func xdgDir(env string, fallback ...string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "redpanda"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(append(append([]string{home}, fallback...), "redpanda")...), nil
+}
+
+// merge sets the values of c that are set in other
+func (c *Config) merge(other Config) {
+	for _, s := range settings {
+		if v := *s.value(&other); v != "" {
+			*s.value(c) = v
+		}
+	}
+
+	if other.Workers != 0 {
+		c.Workers = other.Workers
+	}
+}
+
+// Load reads the configuration from, in order of precedence, command line
+// arguments, environment variables, and the configuration file. The configuration
+// file is config.toml in the configuration directory, unless another is passed
+// with --config or REDPANDA_CONFIG
+func Load(args []string) (Config, error) {
+	flags := Config{}
+	configFile := ""
+
+	fs := flag.NewFlagSet("redpanda", flag.ContinueOnError)
+	fs.StringVar(&configFile, "config", "", "Configuration file")
+	for _, s := range settings {
+		fs.StringVar(s.value(&flags), s.flag, "", s.usage)
+	}
+	fs.IntVar(&flags.Workers, "workers", 0, "Number of repositories to work on at once")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	env := Config{}
+	for _, s := range settings {
+		*s.value(&env) = os.Getenv(s.env)
+	}
+	if workers := os.Getenv("REDPANDA_WORKERS"); workers != "" {
+		n, err := strconv.Atoi(workers)
+		if err != nil {
+			return Config{}, fmt.Errorf("REDPANDA_WORKERS must be a number: %w", err)
+		}
+		env.Workers = n
+	}
+
+	overrides := Config{}
+	overrides.merge(env)
+	overrides.merge(flags)
+
+	if overrides.ConfigDir == "" {
+		dir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+		if err != nil {
+			return Config{}, err
+		}
+		overrides.ConfigDir = dir
+	}
+
+	// The configuration file is optional, unless it was passed explicitly
+	explicit := true
+	if configFile == "" {
+		configFile = os.Getenv("REDPANDA_CONFIG")
+	}
+	if configFile == "" {
+		configFile = filepath.Join(overrides.ConfigDir, "config.toml")
+		explicit = false
+	}
+
+	file := Config{}
+	if _, err := toml.DecodeFile(configFile, &file); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return Config{}, fmt.Errorf("Failed to read configuration file %s: %w", configFile, err)
+		}
+	}
+
+	result := Config{ConfigDir: overrides.ConfigDir}
+	result.merge(file)
+	result.merge(overrides)
+
+	if err := result.setDefaults(); err != nil {
+		return Config{}, err
+	}
+
+	return result, nil
+}
+
+// Identity returns the commit identity of the server
+func (c Config) Identity() store.CommitIdentity {
+	return store.CommitIdentity{
+		Name:       c.CommitName,
+		Email:      c.CommitEmail,
+		Signing:    c.Signing,
+		SigningKey: c.SigningKey,
+	}
+}
+
+func (c *Config) setDefaults() error {
+	if c.DataDir == "" {
+		dir, err := xdgDir("XDG_DATA_HOME", ".local", "share")
+		if err != nil {
+			return err
+		}
+		c.DataDir = dir
+	}
+
+	defaults := []struct {
+		value    *string
+		fallback string
+	}{
+		{&c.DataFile, filepath.Join(c.ConfigDir, "data.json")},
+		{&c.DownloadDir, filepath.Join(c.DataDir, "downloads")},
+		{&c.LedgerDir, filepath.Join(c.DataDir, "transaction-repo")},
+		{&c.LedgerURL, defaultLedgerURL},
+		{&c.PluginDir, filepath.Join(c.DataDir, "plugins")},
+		{&c.LogFile, filepath.Join(c.DataDir, "redpanda.log")},
+		{&c.Address, defaultAddress},
+	}
+	for _, d := range defaults {
+		if *d.value == "" {
+			*d.value = d.fallback
+		}
+	}
+
+	if c.Workers == 0 {
+		c.Workers = defaultWorkers
+	}
+	if c.Workers < 0 {
+		return fmt.Errorf("Number of workers must not be negative")
+	}
+
+	if err := c.Identity().Validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -3,8 +3,12 @@ module github.com/hyperupcall/redpanda/server
 go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/bmatcuk/doublestar/v4 v4.6.1
 	github.com/gin-gonic/gin v1.8.2
 	github.com/google/uuid v1.3.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// TransformerChanges records the files that a transformer changed in a repository,
+// along with the diff of only those changes
+type TransformerChanges struct {
+	Repo        string   `json:"repo"`
+	Transformer string   `json:"transformer"`
+	Files       []string `json:"files"`
+	Diff        string   `json:"diff"`
+}
+
+// gitWriteTree returns the id of a tree object with the staged content of a
+// repository
+func gitWriteTree(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "write-tree")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// changedFiles returns the files that differ between two trees
+func changedFiles(dir string, from string, to string) ([]string, error) {
+	cmd := exec.Command("git", "-C", dir, "diff", "--name-only", "-z", "--no-renames", from, to)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// A changeTracker snapshots the index of a repository after every transformer, to
+// tell which transformer made which changes. Since executeModifiers stages the
+// result of each transformer, the difference between consecutive snapshots is
+// exactly what the transformer in between did
+type changeTracker struct {
+	repo     *store.Repo
+	original string
+	latest   string
+	changes  []TransformerChanges
+}
+
+func newChangeTracker(repo *store.Repo) (*changeTracker, error) {
+	tree, err := gitWriteTree(repo.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write tree of %s: %w", repo.Name, err)
+	}
+
+	return &changeTracker{
+		repo:     repo,
+		original: tree,
+		latest:   tree,
+		changes:  []TransformerChanges{},
+	}, nil
+}
+
+// observe is passed to executeModifiers
+func (t *changeTracker) observe(repo *store.Repo, transformer store.Transformer) error {
+	tree, err := gitWriteTree(repo.Dir)
+	if err != nil {
+		return fmt.Errorf("Failed to write tree of %s: %w", repo.Name, err)
+	}
+
+	changes := TransformerChanges{
+		Repo:        repo.Name,
+		Transformer: transformer.Name,
+		Files:       []string{},
+	}
+
+	if tree != t.latest {
+		changes.Files, err = changedFiles(repo.Dir, t.latest, tree)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command("git", "-C", repo.Dir, "diff", "--find-renames", t.latest, tree)
+		diff, err := cmd.Output()
+		if err != nil {
+			return err
+		}
+		changes.Diff = string(diff)
+	}
+
+	t.changes = append(t.changes, changes)
+	t.latest = tree
+
+	return nil
+}
+
+// restore resets the repository to its state from when the tracker was created
+func (t *changeTracker) restore() error {
+	cmd := exec.Command("git", "-C", t.repo.Dir, "read-tree", "-u", "--reset", t.original)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to restore %s: %w: %s", t.repo.Name, err, output)
+	}
+
+	return nil
+}
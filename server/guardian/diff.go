@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RepoDiff is the staged diff of a single repository. Raw is the output of 'git
+// diff', for displaying as is
+type RepoDiff struct {
+	Repo    string     `json:"repo"`
+	Files   []FileDiff `json:"files"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Raw     string     `json:"raw"`
+}
+
+// FileDiff is the diff of a single file. Status is one of "added", "modified",
+// "deleted", "renamed", "copied", or "type-changed". OldPath is only set for
+// renames and copies. Binary files have neither line counts nor hunks
+type FileDiff struct {
+	Path    string     `json:"path"`
+	OldPath string     `json:"oldPath,omitempty"`
+	Status  string     `json:"status"`
+	Binary  bool       `json:"binary"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Hunks   []DiffHunk `json:"hunks"`
+}
+
+// DiffHunk is a single hunk of a diff. Lines includes the leading ' ', '+', or '-'
+// of each line
+type DiffHunk struct {
+	Header   string   `json:"header"`
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+var diffHunkRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+var diffStatuses = map[byte]string{
+	'A': "added",
+	'M': "modified",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'T': "type-changed",
+}
+
+// diffArgs are shared by every invocation of 'git diff', so that the files of each
+// output are in the same order
+var diffArgs = []string{"diff", "--staged", "--find-renames", "--no-color", "--no-ext-diff"}
+
+func gitDiffOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append(append([]string{"-C", dir}, diffArgs...), args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to run 'git diff' in %s: %w", dir, err)
+	}
+
+	return string(output), nil
+}
+
+// parseNameStatus parses the output of 'git diff --name-status -z'
+func parseNameStatus(output string) ([]FileDiff, error) {
+	fields := strings.Split(output, "\x00")
+	files := []FileDiff{}
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+
+		code := fields[i][0]
+		status, ok := diffStatuses[code]
+		if !ok {
+			status = "modified"
+		}
+
+		file := FileDiff{Status: status, Hunks: []DiffHunk{}}
+		if code == 'R' || code == 'C' {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("Unexpected end of 'git diff --name-status' output")
+			}
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i += 2
+		} else {
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("Unexpected end of 'git diff --name-status' output")
+			}
+			file.Path = fields[i+1]
+			i++
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// applyNumstat sets the line counts of files from the output of 'git diff --numstat
+// -z', which lists files in the same order
+func applyNumstat(files []FileDiff, output string) error {
+	fields := strings.Split(output, "\x00")
+	n := 0
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("Unexpected 'git diff --numstat' output: %q", fields[i])
+		}
+
+		// Renames and copies have an empty path, followed by both paths
+		if parts[2] == "" {
+			i += 2
+		}
+
+		if n >= len(files) {
+			return fmt.Errorf("'git diff --numstat' listed more files than 'git diff --name-status'")
+		}
+
+		if parts[0] == "-" && parts[1] == "-" {
+			files[n].Binary = true
+		} else {
+			files[n].Added, _ = strconv.Atoi(parts[0])
+			files[n].Removed, _ = strconv.Atoi(parts[1])
+		}
+		n++
+	}
+
+	return nil
+}
+
+// parseHunks returns the hunks of each file of a patch, in order
+func parseHunks(patch string) [][]DiffHunk {
+	result := [][]DiffHunk{}
+	var hunks []DiffHunk
+
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			if hunks != nil {
+				result = append(result, hunks)
+			}
+			hunks = []DiffHunk{}
+			continue
+		}
+
+		if hunks == nil {
+			continue
+		}
+
+		if matches := diffHunkRegex.FindStringSubmatch(line); matches != nil {
+			hunk := DiffHunk{Header: line, OldLines: 1, NewLines: 1, Lines: []string{}}
+			hunk.OldStart, _ = strconv.Atoi(matches[1])
+			hunk.NewStart, _ = strconv.Atoi(matches[3])
+			if matches[2] != "" {
+				hunk.OldLines, _ = strconv.Atoi(matches[2])
+			}
+			if matches[4] != "" {
+				hunk.NewLines, _ = strconv.Atoi(matches[4])
+			}
+			hunks = append(hunks, hunk)
+			continue
+		}
+
+		if len(hunks) > 0 && line != "" && strings.ContainsRune(" +-\\", rune(line[0])) {
+			last := &hunks[len(hunks)-1]
+			last.Lines = append(last.Lines, line)
+		}
+	}
+
+	if hunks != nil {
+		result = append(result, hunks)
+	}
+
+	return result
+}
+
+// structuredDiff returns the staged diff of the repository at dir
+func structuredDiff(name string, dir string) (RepoDiff, error) {
+	diff := RepoDiff{Repo: name}
+
+	nameStatus, err := gitDiffOutput(dir, "--name-status", "-z")
+	if err != nil {
+		return diff, err
+	}
+
+	diff.Files, err = parseNameStatus(nameStatus)
+	if err != nil {
+		return diff, err
+	}
+
+	numstat, err := gitDiffOutput(dir, "--numstat", "-z")
+	if err != nil {
+		return diff, err
+	}
+
+	if err := applyNumstat(diff.Files, numstat); err != nil {
+		return diff, err
+	}
+
+	diff.Raw, err = gitDiffOutput(dir)
+	if err != nil {
+		return diff, err
+	}
+
+	hunks := parseHunks(diff.Raw)
+	for i := range diff.Files {
+		if i < len(hunks) {
+			diff.Files[i].Hunks = hunks[i]
+		}
+
+		diff.Added += diff.Files[i].Added
+		diff.Removed += diff.Files[i].Removed
+	}
+
+	return diff, nil
+}
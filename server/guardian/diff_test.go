@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStructuredDiff(t *testing.T) {
+	renamed := strings.Join(numberedLines(1, 10), "\n") + "\n"
+	repo := newGitRepo(t, map[string]string{
+		"changed.txt": strings.Join(numberedLines(1, 20), "\n") + "\n",
+		"old.txt":     renamed,
+		"deleted.txt": "deleted 1\ndeleted 2\n",
+		"image.bin":   "\x00\x01\x02",
+	})
+
+	files := map[string]string{
+		"changed.txt": strings.Join(upperLines(numberedLines(1, 20), 2, 18), "\n") + "\n",
+		"new.txt":     renamed + "line 11\n",
+		"added.txt":   "added\n",
+		"image.bin":   "\x00\x03",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(repo.Dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"old.txt", "deleted.txt"} {
+		if err := os.Remove(filepath.Join(repo.Dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if output, err := exec.Command("git", "-C", repo.Dir, "add", "-A").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %s: %s", err, output)
+	}
+
+	diff, err := structuredDiff(repo.Name, repo.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.Added != 4 || diff.Removed != 4 {
+		t.Errorf("diff: +%d -%d, want +4 -4", diff.Added, diff.Removed)
+	}
+	if !strings.HasPrefix(diff.Raw, "diff --git ") {
+		t.Errorf("raw diff: %q", diff.Raw)
+	}
+
+	// Line counts, and the start, length, and number of lines of each hunk
+	type hunk struct {
+		oldStart, oldLines, newStart, newLines, lines int
+	}
+	tests := []struct {
+		path    string
+		oldPath string
+		status  string
+		binary  bool
+		added   int
+		removed int
+		hunks   []hunk
+	}{
+		{"added.txt", "", "added", false, 1, 0, []hunk{{0, 0, 1, 1, 1}}},
+		{"changed.txt", "", "modified", false, 2, 2, []hunk{{1, 5, 1, 5, 6}, {15, 6, 15, 6, 7}}},
+		{"deleted.txt", "", "deleted", false, 0, 2, []hunk{{1, 2, 0, 0, 2}}},
+		{"image.bin", "", "modified", true, 0, 0, []hunk{}},
+		{"new.txt", "old.txt", "renamed", false, 1, 0, []hunk{{8, 3, 8, 4, 4}}},
+	}
+	if len(diff.Files) != len(tests) {
+		t.Fatalf("%d files, want %d: %+v", len(diff.Files), len(tests), diff.Files)
+	}
+
+	for i, test := range tests {
+		file := diff.Files[i]
+		if file.Path != test.path || file.OldPath != test.oldPath || file.Status != test.status || file.Binary != test.binary {
+			t.Errorf("%s: got %s (from %q), %s, binary %t", test.path, file.Path, file.OldPath, file.Status, file.Binary)
+		}
+		if file.Added != test.added || file.Removed != test.removed {
+			t.Errorf("%s: +%d -%d, want +%d -%d", test.path, file.Added, file.Removed, test.added, test.removed)
+		}
+
+		hunks := []hunk{}
+		for _, h := range file.Hunks {
+			hunks = append(hunks, hunk{h.OldStart, h.OldLines, h.NewStart, h.NewLines, len(h.Lines)})
+		}
+		if !reflect.DeepEqual(hunks, test.hunks) {
+			t.Errorf("%s: hunks %v, want %v", test.path, hunks, test.hunks)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// trackedFiles returns the paths (relative to dir) of every file tracked by git
+func trackedFiles(dir string) ([]string, error) {
+	cmd := exec.Command("git", "-C", dir, "ls-files", "-z")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file == "" {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// matchFiles filters files to those matching at least one include glob (or all
+// files, if there are none) and none of the exclude globs
+func matchFiles(files []string, include []string, exclude []string) ([]string, error) {
+	for _, pattern := range append(include, exclude...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("Invalid glob pattern: %s", pattern)
+		}
+	}
+
+	matched := []string{}
+	for _, file := range files {
+		if len(include) > 0 && !matchesAny(include, file) {
+			continue
+		}
+
+		if matchesAny(exclude, file) {
+			continue
+		}
+
+		matched = append(matched, file)
+	}
+
+	return matched, nil
+}
+
+func matchesAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, file); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileExists reports whether there is a file (or directory) at path
+func fileExists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// isBinary uses the same heuristic as git: content with a NUL byte in the first
+// few kilobytes is considered to be binary
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// transformerFiles returns the tracked files of a repository that match both the
+// globs from the content of a transformer and the scope of the transformer itself
+func transformerFiles(repo *store.Repo, transformer store.Transformer, include []string, exclude []string) ([]string, error) {
+	files, err := trackedFiles(repo.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err = matchFiles(files, include, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchFiles(files, transformer.Include, transformer.Exclude)
+}
+
+// rewriteFiles calls fn with the content of every non-binary, regular file returned
+// by transformerFiles, writing back whatever fn returns if it differs
+func rewriteFiles(repo *store.Repo, transformer store.Transformer, include []string, exclude []string, fn func(file string, content []byte) ([]byte, error)) error {
+	files, err := transformerFiles(repo, transformer, include, exclude)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(repo.Dir, file)
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isBinary(content) {
+			continue
+		}
+
+		newContent, err := fn(file, content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if bytes.Equal(newContent, content) {
+			continue
+		}
+
+		if err := ioutil.WriteFile(path, newContent, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transformerAppliesTo reports whether a repository is selected by the repo name
+// patterns and tags of a transformer. Empty selectors match every repository
+func transformerAppliesTo(transformer store.Transformer, repo *store.Repo) bool {
+	if len(transformer.Repos) > 0 && !matchesAny(transformer.Repos, repo.Name) {
+		return false
+	}
+
+	if len(transformer.Tags) > 0 {
+		for _, tag := range transformer.Tags {
+			for _, repoTag := range repo.Tags {
+				if tag == repoTag {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// discardUnscopedChanges reverts changes made by a transformer to files outside of
+// its scope. Since the results of previous transformers are already staged, any
+// unstaged change was made by the transformer that just ran
+func discardUnscopedChanges(repo *store.Repo, transformer store.Transformer) error {
+	if len(transformer.Include) == 0 && len(transformer.Exclude) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command("git", "-C", repo.Dir, "status", "--porcelain", "-z", "--untracked-files=all")
+	output, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+
+		status, file := entry[:2], entry[3:]
+
+		// Renames and copies are followed by their original path
+		if status[0] == 'R' || status[0] == 'C' {
+			i++
+		}
+
+		inScope, err := matchFiles([]string{file}, transformer.Include, transformer.Exclude)
+		if err != nil {
+			return err
+		}
+		if len(inScope) > 0 {
+			continue
+		}
+
+		if status == "??" {
+			if err := os.Remove(filepath.Join(repo.Dir, file)); err != nil {
+				return err
+			}
+		} else if status[1] != ' ' {
+			cmd := exec.Command("git", "-C", repo.Dir, "checkout", "--", file)
+			if err := cmd.Run(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
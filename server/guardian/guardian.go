@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,55 +13,22 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hyperupcall/redpanda/server/config"
 	"github.com/hyperupcall/redpanda/server/logger"
 	"github.com/hyperupcall/redpanda/server/store"
 )
 
-func New(store *store.Store) Guardian {
-	l := logger.New("redpanda.log")
+func New(store *store.Store, config config.Config) Guardian {
+	l := logger.New(config.LogFile)
 
 	return Guardian{
-		store:  store,
-		logger: &l,
+		store:   store,
+		logger:  &l,
+		config:  config,
+		workers: config.Workers,
 	}
 }
 
-func forEachRepo(m *Guardian, transactionName string, fn func(repo store.Repo) error) error {
-	found := false
-
-	for _, transaction := range m.store.Transactions {
-		if transaction.Name == transactionName {
-			found = true
-
-			originalDir, err := os.Getwd()
-			if err != nil {
-				return err
-			}
-
-			for _, repo := range transaction.Repos {
-				if err := os.Chdir(repo.Dir); err != nil {
-					return err
-				}
-
-				if err = fn(repo); err != nil {
-					return err
-				}
-			}
-
-			if err = os.Chdir(originalDir); err != nil {
-				return err
-			}
-
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("Failed to find a transaction with that particular name")
-	}
-
-	return nil
-}
-
 func RepoIsCloned(dir string) (error, bool) {
 	infos, err := ioutil.ReadDir(dir)
 	if errors.Is(err, os.ErrNotExist) {
@@ -76,277 +44,447 @@ func RepoIsCloned(dir string) (error, bool) {
 	}
 }
 
-func gitDiff(g *Guardian, transactionName string) (string, error) {
-	contents := ""
-	if err := g.forEachRepoInTransactionCd(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
-		cmd := exec.Command("git", "diff", "--staged")
-		content, err := cmd.CombinedOutput()
-		if err != nil {
-			return err
-		}
+// TransformerReport records, for transformers that are able to provide it, the
+// number of matches each transformer made in each file of a repository. For patch
+// transformers, it records how the hunks of each file applied, and for dependency
+// transformers, whether the repository does not depend on the package at all
+type TransformerReport struct {
+	Repo        string                `json:"repo"`
+	Transformer string                `json:"transformer"`
+	Matches     map[string]int        `json:"matches"`
+	Hunks       map[string]HunkReport `json:"hunks,omitempty"`
+	Missing     bool                  `json:"missing,omitempty"`
+}
 
-		contents = contents + string(content)
+// TransformerError records that a transformer failed in a repository
+type TransformerError struct {
+	Repo        string `json:"repo"`
+	Transformer string `json:"transformer"`
+	Error       string `json:"error"`
+}
 
-		return nil
-	}); err != nil {
-		return "", err
+// runTransformer runs a single transformer in a repository, and stages its changes.
+// Only some types of transformers return a report
+func runTransformer(g *Guardian, repo *store.Repo, former store.Transformer) (*TransformerReport, error) {
+	former, err := renderTransformer(former, repo)
+	if err != nil {
+		return nil, err
 	}
 
-	return contents, nil
-}
-
-func gitReset(g *Guardian, transactionName string) (string, error) {
-	contents := ""
-	if err := g.forEachRepoInTransactionCd(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
-		cmd := exec.Command("git", "reset", "--hard", "HEAD")
-		content, err := cmd.CombinedOutput()
+	var report *TransformerReport
+	switch former.Type {
+	case "command":
+		// Each repository gets its own script, since they may run concurrently
+		script, err := ioutil.TempFile("", "redpanda-script-*.sh")
 		if err != nil {
-			return err
+			return nil, err
 		}
+		defer os.Remove(script.Name())
 
-		contents = contents + string(content)
+		if _, err := script.WriteString(former.Content); err != nil {
+			script.Close()
+			return nil, err
+		}
+		if err := script.Close(); err != nil {
+			return nil, err
+		}
 
-		return nil
-	}); err != nil {
-		return "", err
-	}
+		var stderr bytes.Buffer
+		cmd := exec.Command("bash", script.Name())
+		cmd.Dir = repo.Dir
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, &StepError{Step: "transform", Stderr: strings.TrimSpace(stderr.String()), Err: err}
+		}
 
-	return contents, nil
-}
+		// l := strings.Split(former.Content, " ")
 
-func executeModifiers(g *Guardian, transactionName string) error {
-	if err := g.forEachRepoInTransactionCd(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
-		cmd := exec.Command("git", "merge-base", "origin", "HEAD")
-		_, err := cmd.Output()
+		// cmd := exec.Command(l[0], l...)
+		// if err := cmd.Run(); err != nil {
+		// 	return err
+		// }
+	case "regex":
+		if err := transformRegex(repo, former); err != nil {
+			return nil, err
+		}
+	case "replace":
+		if err := transformReplace(repo, former); err != nil {
+			return nil, err
+		}
+	case "go-rewrite":
+		if err := transformGoRewrite(repo, former); err != nil {
+			return nil, err
+		}
+	case "structured-edit":
+		if err := transformStructuredEdit(repo, former); err != nil {
+			return nil, err
+		}
+	case "starlark":
+		if err := transformStarlark(g, repo, former); err != nil {
+			return nil, err
+		}
+	case "patch":
+		r, err := transformPatch(repo, former)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		report = &r
+	case "dependency":
+		r, err := transformDependency(g, repo, former)
+		if err != nil {
+			return nil, err
+		}
+		report = &r
+	case "header":
+		if err := transformHeader(repo, former); err != nil {
+			return nil, err
+		}
+	case "file-write":
+		if err := transformFileWrite(g, repo, former); err != nil {
+			return nil, err
+		}
+	case "file-delete":
+		if err := transformFileDelete(repo, former); err != nil {
+			return nil, err
+		}
+	case "file-move":
+		if err := transformFileMove(g, repo, former); err != nil {
+			return nil, err
+		}
+	case "comby":
+		r, err := transformComby(repo, former)
+		if err != nil {
+			return nil, err
+		}
+		report = &r
+	default:
+		if err := transformPlugin(g, repo, former); err != nil {
+			return nil, err
 		}
+	}
 
-		for _, former := range transaction.Transformers {
-			if former.Type == "command" {
-				fileName := "/tmp/redpanda-script.sh"
+	if err := discardUnscopedChanges(repo, former); err != nil {
+		return nil, err
+	}
 
-				if err := ioutil.WriteFile(fileName, []byte(former.Content), 0o755); err != nil {
-					return err
-				}
+	cmd := exec.Command("git", "-C", repo.Dir, "add", "-A")
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
 
-				cmd := exec.Command("bash", fileName)
-				if err := cmd.Run(); err != nil {
-					return err
-				}
+	return report, nil
+}
 
-				// l := strings.Split(former.Content, " ")
+// executeModifiers runs the transformers of a transaction in one of its repositories,
+// staging the result of each one. If observe is not nil, it is called after each
+// transformer has run (and its changes have been staged). Along with reports, it
+// returns the transformer that failed, if any
+func executeModifiers(g *Guardian, transaction *store.Transaction, repo *store.Repo, observe func(repo *store.Repo, transformer store.Transformer) error) ([]TransformerReport, []TransformerError, error) {
+	reports := []TransformerReport{}
+	failures := []TransformerError{}
 
-				// cmd := exec.Command(l[0], l...)
-				// if err := cmd.Run(); err != nil {
-				// 	return err
-				// }
+	if _, err := gitStep("merge-base", repo.Dir, "merge-base", "origin", "HEAD"); err != nil {
+		return reports, failures, err
+	}
 
-				cmd = exec.Command("git", "add", "-A")
-				if err := cmd.Run(); err != nil {
-					return err
-				}
-			} else {
-				panic("Unknown type")
-			}
+	for _, former := range transaction.Transformers {
+		if !transformerAppliesTo(former, repo) {
+			continue
 		}
 
-		return nil
-	}); err != nil {
-		return err
+		report, err := runTransformer(g, repo, former)
+		if err != nil {
+			// Commands that fail return a StepError with their error output, which is
+			// kept by wrapping it rather than replacing it
+			failures = append(failures, TransformerError{
+				Repo:        repo.Name,
+				Transformer: former.Name,
+				Error:       err.Error(),
+			})
+			return reports, failures, newStepError("transform", fmt.Errorf("Transformer '%s' failed: %w", former.Name, err))
+		}
+		if report != nil {
+			reports = append(reports, *report)
+		}
+
+		if observe != nil {
+			if err := observe(repo, former); err != nil {
+				return reports, failures, newStepError("transform", err)
+			}
+		}
 	}
 
-	return nil
+	return reports, failures, nil
 }
 
 type Guardian struct {
-	store  *store.Store
-	logger logger.Logger
+	store   *store.Store
+	logger  logger.Logger
+	config  config.Config
+	workers int
 }
 
+// setRepoStatus records the status of a repository in the store, along with where
+// it is cloned
+func (g *Guardian) setRepoStatus(transaction *store.Transaction, repo *store.Repo, status string) error {
+	repo.Status = status
+	repo.Error = ""
+
+	return g.store.RepoUpdate(transaction.Name, repo.Name, func(r *store.Repo) {
+		r.URL = repo.URL
+		r.Dir = repo.Dir
+		r.Status = repo.Status
+		r.Error = repo.Error
+	})
+}
+
+// forEachRepoInTransaction calls fn for every repository of a transaction, until
+// one fails. Repositories that fail are recorded as such
 func (g *Guardian) forEachRepoInTransaction(transactionName string, fn func(transaction *store.Transaction, repo *store.Repo) error) error {
-	foundTransaction := false
+	_, _, err := runRepos(g, transactionName, false, func(transaction *store.Transaction, repo *store.Repo) (struct{}, error) {
+		return struct{}{}, fn(transaction, repo)
+	})
 
-	for i := range g.store.Transactions {
-		transaction := g.store.Transactions[i]
+	return err
+}
 
-		if transaction.Name == transactionName {
-			foundTransaction = true
-			for j := range transaction.Repos {
-				repo := transaction.Repos[j]
+// ApplyResult is the outcome of applying the transformers of a transaction.
+// Contents is the raw staged diff of every repository, Diffs is the same diff
+// broken down by repository, and Changes breaks it down by transformer. Repos is
+// the outcome of each repository as a whole
+type ApplyResult struct {
+	Contents          string               `json:"contents"`
+	Diffs             []RepoDiff           `json:"diffs"`
+	Reports           []TransformerReport  `json:"reports"`
+	Changes           []TransformerChanges `json:"changes"`
+	IdempotencyIssues []IdempotencyIssue   `json:"idempotencyIssues"`
+	Errors            []TransformerError   `json:"errors"`
+	Repos             []RepoResult         `json:"repos"`
+}
 
-				if err := fn(&transaction, &repo); err != nil {
-					return err
-				}
-			}
-		}
+// repoApply is the outcome of applying the transformers of a transaction to one
+// repository
+type repoApply struct {
+	diff     *RepoDiff
+	reports  []TransformerReport
+	failures []TransformerError
+	changes  []TransformerChanges
+	issues   []IdempotencyIssue
+}
+
+// transformRepo resets a repository, and applies the transformers of its transaction
+func transformRepo(g *Guardian, transaction *store.Transaction, repo *store.Repo, verify bool) (repoApply, error) {
+	result := repoApply{}
+
+	if err := checkWorkTree("reset", repo.Dir); err != nil {
+		return result, err
 	}
 
-	if !foundTransaction {
-		return fmt.Errorf("Failed to find transaction with a name of %s", transactionName)
+	if _, err := gitStep("reset", repo.Dir, "reset", "--hard", "HEAD"); err != nil {
+		return result, err
 	}
 
-	return nil
-}
+	tracker, err := newChangeTracker(repo)
+	if err != nil {
+		return result, newStepError("transform", err)
+	}
+
+	result.reports, result.failures, err = executeModifiers(g, transaction, repo, tracker.observe)
+	result.changes = tracker.changes
+	if err != nil {
+		return result, err
+	}
+
+	diff, err := structuredDiff(repo.Name, repo.Dir)
+	if err != nil {
+		return result, newStepError("diff", err)
+	}
+	result.diff = &diff
+
+	// A repository without changes is only as far along as it already was, unless
+	// the changes it had were discarded
+	status := repo.Status
+	if len(diff.Files) > 0 {
+		status = store.StatusDirty
+	} else if status != store.StatusCommitted && status != store.StatusPushed {
+		status = store.StatusCloned
+	}
+	if err := g.setRepoStatus(transaction, repo, status); err != nil {
+		return result, newStepError("diff", err)
+	}
 
-func (g *Guardian) forEachRepoInTransactionCd(transactionName string, fn func(transaction *store.Transaction, repo *store.Repo) error) error {
-	g.forEachRepoInTransaction(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
-		originalDir, err := os.Getwd()
+	if verify {
+		result.issues, err = verifyIdempotency(g, transaction, repo)
 		if err != nil {
-			return err
+			return result, newStepError("verify", err)
 		}
+	}
 
-		if err = os.Chdir(repo.Dir); err != nil {
-			return err
-		}
+	return result, nil
+}
 
-		if err := fn(transaction, repo); err != nil {
-			return err
+// transform applies the transformers of a transaction to each of its repositories,
+// after calling prepare on it
+func (g *Guardian) transform(transactionName string, verify bool, continueOnError bool, prepare func(transaction *store.Transaction, repo *store.Repo) error) (ApplyResult, error) {
+	applied, repos, err := runRepos(g, transactionName, continueOnError, func(transaction *store.Transaction, repo *store.Repo) (repoApply, error) {
+		if err := prepare(transaction, repo); err != nil {
+			return repoApply{}, err
 		}
 
-		if err = os.Chdir(originalDir); err != nil {
-			return err
+		return transformRepo(g, transaction, repo, verify)
+	})
+	if err != nil {
+		return ApplyResult{}, err
+	}
+
+	result := ApplyResult{
+		Diffs:             []RepoDiff{},
+		Reports:           []TransformerReport{},
+		Changes:           []TransformerChanges{},
+		IdempotencyIssues: []IdempotencyIssue{},
+		Errors:            []TransformerError{},
+		Repos:             repos,
+	}
+	for _, a := range applied {
+		if a.diff != nil {
+			result.Contents = result.Contents + a.diff.Raw
+			result.Diffs = append(result.Diffs, *a.diff)
 		}
+		result.Reports = append(result.Reports, a.reports...)
+		result.Changes = append(result.Changes, a.changes...)
+		result.IdempotencyIssues = append(result.IdempotencyIssues, a.issues...)
+		result.Errors = append(result.Errors, a.failures...)
+	}
 
-		return nil
-	})
-	return nil
+	return result, nil
 }
 
-func (g *Guardian) ActionApply(transactionName string) (string, error) {
-	if err := g.forEachRepoInTransaction(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
-		if repo.Status == "uninitialized" {
-			g.logger.Info("Initializing " + repo.Name)
+// ActionApply clones the repositories of a transaction that are not yet, and applies
+// its transformers. If continueOnError is true, repositories that fail do not stop
+// the others, and are only reported in the Repos of the result
+func (g *Guardian) ActionApply(transactionName string, verify bool, continueOnError bool) (ApplyResult, error) {
+	return g.transform(transactionName, verify, continueOnError, func(transaction *store.Transaction, repo *store.Repo) error {
+		if repo.Dir == "" {
+			repo.Dir = filepath.Join(g.config.DownloadDir, repo.Name)
+		}
 
-			url := fmt.Sprintf("git@github.com:%s", repo.Name)
-			dir := filepath.Join(os.Getenv("HOME"), ".local", "share", "redpanda", "downloads", repo.Name)
+		err, isCloned := RepoIsCloned(repo.Dir)
+		if err != nil {
+			return newStepError("clone", err)
+		}
 
-			repo.URL = url
-			repo.Dir = dir
+		if !isCloned {
+			g.logger.Info("Initializing " + repo.Name)
 
-			err, isCloned := RepoIsCloned(dir)
+			url, args, err := cloneSource(g.store, repo)
 			if err != nil {
-				return err
+				return newStepError("clone", err)
 			}
+			repo.URL = url
 
-			if !isCloned {
-				cmd := exec.Command("git", "clone", url, dir)
-				cmd.Stdin = os.Stdin
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
+			if err := g.setRepoStatus(transaction, repo, store.StatusCloning); err != nil {
+				return newStepError("clone", err)
+			}
 
-				if err := cmd.Run(); err != nil {
-					return err
-				}
+			cmd := exec.Command("git", append(append([]string{"clone"}, args...), repo.URL, repo.Dir)...)
+			if _, err := cmd.Output(); err != nil {
+				return newStepError("clone", err)
 			}
 
-			repo.Status = "initialized"
+			if err := g.setRepoStatus(transaction, repo, store.StatusCloned); err != nil {
+				return newStepError("clone", err)
+			}
 		}
 
 		return nil
-	}); err != nil {
-		return "", err
-	}
-
-	if _, err := gitReset(g, transactionName); err != nil {
-		return "", err
-	}
-
-	if err := executeModifiers(g, transactionName); err != nil {
-		return "", err
-	}
-
-	return gitDiff(g, transactionName)
+	})
 }
 
-func (g *Guardian) ActionRefresh(transactionName string) (string, error) {
-	if err := g.forEachRepoInTransactionCd(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
-		if err := os.Chdir(repo.Dir); err != nil {
-			fmt.Println(repo.Dir)
+// ActionRefresh updates the repositories of a transaction from their remotes, and
+// applies its transformers. continueOnError is as with ActionApply
+func (g *Guardian) ActionRefresh(transactionName string, verify bool, continueOnError bool) (ApplyResult, error) {
+	return g.transform(transactionName, verify, continueOnError, func(transaction *store.Transaction, repo *store.Repo) error {
+		if err := checkWorkTree("fetch", repo.Dir); err != nil {
 			return err
 		}
 
 		g.logger.Trace("git fetch: " + repo.Name)
-		cmd := exec.Command("git", "fetch", "origin")
-		if err := cmd.Run(); err != nil {
+		if _, err := gitStep("fetch", repo.Dir, "fetch", "origin"); err != nil {
 			return err
 		}
 
 		g.logger.Trace("git merge-base: " + repo.Name)
-		cmd = exec.Command("git", "merge-base", "origin", "HEAD")
-		mergeBase, err := cmd.Output()
+		mergeBase, err := gitStep("merge-base", repo.Dir, "merge-base", "origin", "HEAD")
 		if err != nil {
 			return err
 		}
 
 		g.logger.Trace("git reset: " + repo.Name)
-		cmd = exec.Command("git", "-C", repo.Dir, "reset", "--hard", strings.TrimSpace(string(mergeBase)))
-		if err := cmd.Run(); err != nil {
+		if _, err := gitStep("reset", repo.Dir, "reset", "--hard", strings.TrimSpace(mergeBase)); err != nil {
 			return err
 		}
 
 		g.logger.Trace("git pull: " + repo.Name)
-		cmd = exec.Command("git", "pull", "origin")
-		if err := cmd.Run(); err != nil {
+		if _, err := gitStep("pull", repo.Dir, "pull", "origin"); err != nil {
 			return err
 		}
 
-		return nil
-	}); err != nil {
-		return "", err
-	}
+		return g.setRepoStatus(transaction, repo, store.StatusCloned)
+	})
+}
 
-	if _, err := gitReset(g, transactionName); err != nil {
-		return "", err
+// ActionSummary applies the transformers of a transaction, and summarizes the result.
+// Repositories that fail are summarized as errored, rather than failing the summary
+func (g *Guardian) ActionSummary(transactionName string) (Summary, error) {
+	result, err := g.ActionApply(transactionName, false, true)
+	if err != nil {
+		return Summary{}, err
 	}
 
-	if err := executeModifiers(g, transactionName); err != nil {
-		return "", err
+	transaction, err := g.store.TransactionGet(transactionName)
+	if err != nil {
+		return Summary{}, err
 	}
 
-	return gitDiff(g, transactionName)
+	return summarize(transaction, result), nil
 }
 
 func (g *Guardian) ActionCommit(transactionName string, commitMessage string) (string, error) {
-	transactionRepoDir := filepath.Join(os.Getenv("HOME"), ".local", "share", "redpanda", "transaction-repo")
+	transactionRepoDir := g.config.LedgerDir
 
 	err, isCloned := RepoIsCloned(transactionRepoDir)
 	if err != nil {
 		return "", err
 	}
 	if !isCloned {
-		cmd := exec.Command("git", "clone", "git@github.com:hyperupcall/transactions", transactionRepoDir)
-		if err := cmd.Run(); err != nil {
-			return "", err
+		cmd := exec.Command("git", "clone", g.config.LedgerURL, transactionRepoDir)
+		if _, err := cmd.Output(); err != nil {
+			return "", newStepError("clone the transaction repository", err)
 		}
 	}
 
-	config := struct {
-		gitAuthor string
-		gpgId     string
-	}{
-		gitAuthor: "Captain Woofers <99463792+captain-woofers@users.noreply.github.com>",
-		gpgId:     "0xF1BBE0168CC63A97",
+	transaction, err := findTransaction(g, transactionName)
+	if err != nil {
+		return "", err
 	}
+	identity := g.commitIdentity(transaction)
 	id := uuid.NewString()
 
-	os.Setenv("GIT_COMMITTER_NAME", "Captain Woofers")
-	os.Setenv("GIT_COMMITTER_EMAIL", "99463792+captain-woofers@users.noreply.github.com")
-
 	message := commitMessage + `
 
 Transaction-Id: ` + id + ``
 
-	if err := forEachRepo(g, transactionName, func(repo store.Repo) error {
-
-		cmd := exec.Command("git", "commit", "--allow-empty", "-m", message, "--author", config.gitAuthor, "--gpg-sign="+config.gpgId)
-		content, err := cmd.CombinedOutput()
-		fmt.Println(string(content))
-		if err != nil {
+	if err := g.forEachRepoInTransaction(transactionName, func(transaction *store.Transaction, repo *store.Repo) error {
+		if err := checkWorkTree("commit", repo.Dir); err != nil {
 			return err
 		}
 
-		return nil
+		cmd := commitCommand(repo.Dir, identity, "--allow-empty", "-m", message)
+		if _, err := cmd.Output(); err != nil {
+			return newStepError("commit", err)
+		}
+
+		return g.setRepoStatus(transaction, repo, store.StatusCommitted)
 	}); err != nil {
 		return "{}", err
 	}
@@ -390,41 +528,55 @@ Transaction-Id: ` + id + ``
 	}
 
 	g.logger.Trace("transaction-repo: Adding")
-	cmd := exec.Command("git", "-C", transactionRepoDir, "add", dataFile)
-	if err := cmd.Run(); err != nil {
+	if err := checkWorkTree("record the transaction", transactionRepoDir); err != nil {
+		return "", err
+	}
+
+	if _, err := gitStep("record the transaction", transactionRepoDir, "add", dataFile); err != nil {
 		return "", err
 	}
 
 	transactionMessage := message
 
-	cmd = exec.Command("git", "-C", transactionRepoDir, "commit", "-m", transactionMessage)
-	if err := cmd.Run(); err != nil {
-		return "", err
+	cmd := commitCommand(transactionRepoDir, identity, "-m", transactionMessage)
+	if _, err := cmd.Output(); err != nil {
+		return "", newStepError("record the transaction", err)
 	}
 
 	return "{}", nil
 }
 
-func (m *Guardian) ActionPush(transactionName string) (string, error) {
-	err := forEachRepo(m, transactionName, func(repo store.Repo) error {
-		cmd := exec.Command("git", "push", "origin")
-		content, err := cmd.CombinedOutput()
-		fmt.Println(string(content))
-		if err != nil {
-			return err
+// PushResult is the outcome of pushing each repository of a transaction
+type PushResult struct {
+	Repos []RepoResult `json:"repos"`
+}
+
+// ActionPush pushes the repositories of a transaction, and then the record of the
+// transaction. continueOnError is as with ActionApply
+func (m *Guardian) ActionPush(transactionName string, continueOnError bool) (PushResult, error) {
+	_, repos, err := runRepos(m, transactionName, continueOnError, func(transaction *store.Transaction, repo *store.Repo) (struct{}, error) {
+		if err := checkWorkTree("push", repo.Dir); err != nil {
+			return struct{}{}, err
 		}
 
-		return nil
+		if _, err := gitStep("push", repo.Dir, "push", "origin"); err != nil {
+			return struct{}{}, err
+		}
+
+		return struct{}{}, m.setRepoStatus(transaction, repo, store.StatusPushed)
 	})
 	if err != nil {
-		return "{}", err
+		return PushResult{}, err
 	}
 
-	transactionRepoDir := filepath.Join(os.Getenv("HOME"), ".local", "share", "redpanda", "transaction-repo")
-	cmd := exec.Command("git", "-C", transactionRepoDir, "push", "origin")
-	if err := cmd.Run(); err != nil {
-		return "", err
+	transactionRepoDir := m.config.LedgerDir
+	if err := checkWorkTree("push the transaction repository", transactionRepoDir); err != nil {
+		return PushResult{}, err
 	}
 
-	return "{}", nil
+	if _, err := gitStep("push the transaction repository", transactionRepoDir, "push", "origin"); err != nil {
+		return PushResult{}, err
+	}
+
+	return PushResult{Repos: repos}, nil
 }
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+const defaultHost = "github"
+
+// isLocalPath returns whether url is a path to a repository on disk, rather than a
+// URL. Like git, "file://" URLs are treated as URLs
+func isLocalPath(url string) bool {
+	return filepath.IsAbs(url) || strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../")
+}
+
+// cloneSource returns the URL to clone a repository from, along with arguments
+// that configure the clone (for example, a credential helper). Repositories with
+// a URL are cloned from it, and others are cloned from their host
+func cloneSource(s *store.Store, repo *store.Repo) (string, []string, error) {
+	if repo.URL != "" {
+		if isLocalPath(repo.URL) {
+			path, err := filepath.Abs(repo.URL)
+			if err != nil {
+				return "", nil, err
+			}
+
+			return path, nil, nil
+		}
+
+		return repo.URL, nil, nil
+	}
+
+	name := repo.Host
+	if name == "" {
+		name = defaultHost
+	}
+
+	host, err := s.HostGet(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to find host %s of %s: %w", name, repo.Name, err)
+	}
+
+	switch host.Protocol {
+	case "https":
+		domain := host.Domain
+		if host.Port != 0 {
+			domain = fmt.Sprintf("%s:%d", domain, host.Port)
+		}
+
+		args := []string{}
+		if host.CredentialHelper != "" {
+			args = append(args, "--config", "credential.helper="+host.CredentialHelper)
+		}
+
+		return fmt.Sprintf("https://%s/%s", domain, repo.Name), args, nil
+	case "", "ssh":
+		user := host.User
+		if user == "" {
+			user = "git"
+		}
+
+		// The scp-like syntax does not allow for a port
+		if host.Port != 0 {
+			return fmt.Sprintf("ssh://%s@%s:%d/%s", user, host.Domain, host.Port, repo.Name), nil, nil
+		}
+
+		return fmt.Sprintf("%s@%s:%s", user, host.Domain, repo.Name), nil, nil
+	default:
+		return "", nil, fmt.Errorf("Protocol of host %s must be either ssh or https", host.Name)
+	}
+}
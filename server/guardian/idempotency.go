@@ -0,0 +1,55 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// IdempotencyIssue records that running a transformer again, on a repository it
+// was already applied to, changed files
+type IdempotencyIssue struct {
+	Repo        string   `json:"repo"`
+	Transformer string   `json:"transformer"`
+	Files       []string `json:"files"`
+}
+
+// verifyIdempotency runs the transformers of a transaction a second time, on an
+// already transformed repository, and returns an issue for every transformer that
+// made further changes. Afterwards, the repository is restored to how it was after
+// the first run
+func verifyIdempotency(g *Guardian, transaction *store.Transaction, repo *store.Repo) ([]IdempotencyIssue, error) {
+	tracker, err := newChangeTracker(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, runErr := executeModifiers(g, transaction, repo, tracker.observe)
+
+	// Restore the repository even if the second run failed, so it is left with the
+	// result of the first
+	if err := tracker.restore(); err != nil {
+		return nil, fmt.Errorf("Failed to undo verification of idempotency: %w", err)
+	}
+
+	if runErr != nil {
+		return nil, fmt.Errorf("Failed to run transformers a second time: %w", runErr)
+	}
+
+	issues := []IdempotencyIssue{}
+	for _, changes := range tracker.changes {
+		if len(changes.Files) == 0 {
+			continue
+		}
+
+		g.logger.Info(fmt.Sprintf("Transformer '%s' is not idempotent in %s (changed %s)", changes.Transformer, changes.Repo, strings.Join(changes.Files, ", ")))
+		issues = append(issues, IdempotencyIssue{
+			Repo:        changes.Repo,
+			Transformer: changes.Transformer,
+			Files:       changes.Files,
+		})
+	}
+
+	return issues, nil
+}
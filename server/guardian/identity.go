@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// commitIdentity returns the commit identity of a transaction, with fields it does
+// not set taken from the configuration of the server
+func (g *Guardian) commitIdentity(transaction *store.Transaction) store.CommitIdentity {
+	identity := g.config.Identity()
+
+	if transaction.Identity.Name != "" {
+		identity.Name = transaction.Identity.Name
+	}
+	if transaction.Identity.Email != "" {
+		identity.Email = transaction.Identity.Email
+	}
+	if transaction.Identity.Signing != "" {
+		identity.Signing = transaction.Identity.Signing
+		identity.SigningKey = transaction.Identity.SigningKey
+	} else if transaction.Identity.SigningKey != "" {
+		identity.SigningKey = transaction.Identity.SigningKey
+	}
+
+	return identity
+}
+
+// commitCommand returns a 'git commit' command that commits as identity. The
+// identity is only passed to the command, so that commits of other transactions
+// (and git commands of the server) are not affected
+func commitCommand(dir string, identity store.CommitIdentity, args ...string) *exec.Cmd {
+	gitArgs := []string{"-C", dir}
+	commitArgs := []string{"commit"}
+
+	switch identity.Signing {
+	case "gpg":
+		gitArgs = append(gitArgs, "-c", "gpg.format=openpgp")
+		if identity.SigningKey != "" {
+			commitArgs = append(commitArgs, "--gpg-sign="+identity.SigningKey)
+		} else {
+			commitArgs = append(commitArgs, "--gpg-sign")
+		}
+	case "ssh":
+		gitArgs = append(gitArgs, "-c", "gpg.format=ssh")
+		if identity.SigningKey != "" {
+			gitArgs = append(gitArgs, "-c", "user.signingKey="+identity.SigningKey)
+		}
+		commitArgs = append(commitArgs, "--gpg-sign")
+	case "none":
+		commitArgs = append(commitArgs, "--no-gpg-sign")
+	}
+
+	cmd := exec.Command("git", append(append(gitArgs, commitArgs...), args...)...)
+	cmd.Env = os.Environ()
+	if identity.Name != "" {
+		cmd.Env = append(cmd.Env, "GIT_AUTHOR_NAME="+identity.Name, "GIT_COMMITTER_NAME="+identity.Name)
+	}
+	if identity.Email != "" {
+		cmd.Env = append(cmd.Env, "GIT_AUTHOR_EMAIL="+identity.Email, "GIT_COMMITTER_EMAIL="+identity.Email)
+	}
+
+	return cmd
+}
@@ -0,0 +1,258 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// Transformer plugins are executables named 'redpanda-transformer-<type>', looked
+// up first in the plugin directory, then in PATH. A plugin is sent a pluginRequest
+// on stdin, and must write a pluginResponse to stdout. Plugins do not need to
+// modify the repository themselves; the edits they respond with are applied for
+// them (and only within the scope of the transformer)
+const pluginProtocolVersion = 1
+
+var pluginTypeRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+type pluginRepo struct {
+	Name          string            `json:"name"`
+	Owner         string            `json:"owner"`
+	Dir           string            `json:"dir"`
+	DefaultBranch string            `json:"defaultBranch"`
+	Tags          []string          `json:"tags"`
+	Variables     map[string]string `json:"variables"`
+}
+
+type pluginTransformer struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type pluginRequest struct {
+	Version     int               `json:"version"`
+	Repo        pluginRepo        `json:"repo"`
+	Transformer pluginTransformer `json:"transformer"`
+	Files       []string          `json:"files"`
+}
+
+// A pluginEdit either replaces the content of (or creates) the file at Path, or
+// deletes it. If Encoding is "base64", Content is decoded before being written
+type pluginEdit struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	Delete   bool   `json:"delete"`
+}
+
+type pluginResponse struct {
+	Edits []pluginEdit `json:"edits"`
+	Error string       `json:"error"`
+}
+
+// findPlugin returns the path to the executable for a transformer type, looking in
+// the plugin directory before PATH
+func findPlugin(pluginDir string, typ string) (string, error) {
+	if !pluginTypeRegex.MatchString(typ) {
+		return "", fmt.Errorf("Unknown transformer type: %s", typ)
+	}
+
+	name := "redpanda-transformer-" + typ
+
+	candidate := filepath.Join(pluginDir, name)
+	if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+		return candidate, nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	executable, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("Unknown transformer type: %s (no plugin named %s was found)", typ, name)
+	}
+
+	return executable, nil
+}
+
+// repoPath returns the absolute path of a file in a repository, making sure that
+// it does not escape the repository, including through symbolic links
+func repoPath(repo *store.Repo, file string) (string, error) {
+	if filepath.IsAbs(file) {
+		return "", fmt.Errorf("Path must be relative to the repository: %s", file)
+	}
+
+	clean := filepath.Clean(file)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Path must be within the repository: %s", file)
+	}
+
+	if clean == ".git" || strings.HasPrefix(clean, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("Path must not be within the .git directory: %s", file)
+	}
+
+	path := filepath.Join(repo.Dir, clean)
+
+	root, err := filepath.EvalSymlinks(repo.Dir)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve repository directory %s: %w", repo.Dir, err)
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve %s: %w", file, err)
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Path must be within the repository: %s", file)
+	}
+
+	if rel == ".git" || strings.HasPrefix(rel, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("Path must not be within the .git directory: %s", file)
+	}
+
+	return path, nil
+}
+
+// resolvePath is like filepath.EvalSymlinks, except that path (and its parents)
+// need not exist. The part of path that does not exist is joined to the resolved
+// part that does. A symbolic link that points to nowhere is an error, as writing
+// to it would create its target
+func resolvePath(path string) (string, error) {
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		if _, err := os.Lstat(path); err == nil {
+			return "", fmt.Errorf("Symbolic link %s is broken", path)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func applyPluginEdit(repo *store.Repo, edit pluginEdit) error {
+	path, err := repoPath(repo, edit.Path)
+	if err != nil {
+		return err
+	}
+
+	if edit.Delete {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	content := []byte(edit.Content)
+	switch edit.Encoding {
+	case "":
+	case "base64":
+		content, err = base64.StdEncoding.DecodeString(edit.Content)
+		if err != nil {
+			return fmt.Errorf("Failed to decode content of %s: %w", edit.Path, err)
+		}
+	default:
+		return fmt.Errorf("Unknown encoding for %s: %s", edit.Path, edit.Encoding)
+	}
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, mode)
+}
+
+func transformPlugin(g *Guardian, repo *store.Repo, transformer store.Transformer) error {
+	executable, err := findPlugin(g.config.PluginDir, transformer.Type)
+	if err != nil {
+		return err
+	}
+
+	files, err := transformerFiles(repo, transformer, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	branch, err := defaultBranch(repo.Dir)
+	if err != nil {
+		return err
+	}
+
+	request, err := json.Marshal(pluginRequest{
+		Version: pluginProtocolVersion,
+		Repo: pluginRepo{
+			Name:          repo.Name,
+			Owner:         repoOwner(repo.Name),
+			Dir:           repo.Dir,
+			DefaultBranch: branch,
+			Tags:          repo.Tags,
+			Variables:     repo.Variables,
+		},
+		Transformer: pluginTransformer{
+			Type:    transformer.Type,
+			Name:    transformer.Name,
+			Content: transformer.Content,
+		},
+		Files: files,
+	})
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(executable)
+	cmd.Dir = repo.Dir
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Plugin %s failed: %w: %s", filepath.Base(executable), err, stderr.String())
+	}
+
+	var response pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return fmt.Errorf("Failed to parse response of plugin %s: %w", filepath.Base(executable), err)
+	}
+
+	if response.Error != "" {
+		return fmt.Errorf("Plugin %s failed: %s", filepath.Base(executable), response.Error)
+	}
+
+	for _, edit := range response.Edits {
+		if err := applyPluginEdit(repo, edit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// findTransaction returns a copy of a transaction, so that repositories can be
+// iterated over while the store is changed
+func findTransaction(g *Guardian, transactionName string) (*store.Transaction, error) {
+	t, err := g.store.TransactionGet(transactionName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find transaction with a name of %s", transactionName)
+	}
+
+	return &t, nil
+}
+
+// mapRepos calls fn for every repository of a transaction, with up to g.workers
+// calls running at once, and returns the results in the order of the repositories.
+// Since calls are concurrent, fn must not change the working directory of the
+// process, or share state without synchronizing it. Once a call fails, no more
+// repositories are started, and the error of the first failing repository (in
+// order) is returned as a RepoError, along with the results so far
+func mapRepos[T any](g *Guardian, transactionName string, fn func(transaction *store.Transaction, repo *store.Repo) (T, error)) ([]T, error) {
+	transaction, err := findTransaction(g, transactionName)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapTransaction(g, transaction, fn)
+}
+
+func mapTransaction[T any](g *Guardian, transaction *store.Transaction, fn func(transaction *store.Transaction, repo *store.Repo) (T, error)) ([]T, error) {
+	results := make([]T, len(transaction.Repos))
+	errs := make([]error, len(transaction.Repos))
+
+	workers := g.workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(transaction.Repos) {
+		workers = len(transaction.Repos)
+	}
+
+	var failed int32
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				repo := transaction.Repos[i]
+				results[i], errs[i] = fn(transaction, &repo)
+				if errs[i] != nil {
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for i := range transaction.Repos {
+		if atomic.LoadInt32(&failed) == 1 {
+			break
+		}
+
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return results, &RepoError{Repo: transaction.Repos[i].Name, Err: err}
+		}
+	}
+
+	return results, nil
+}
+
+// The status of a repository in a RepoResult
+const (
+	RepoSucceeded = "succeeded"
+	RepoFailed    = "failed"
+	RepoSkipped   = "skipped"
+)
+
+// RepoResult is the outcome of an action in one repository. For failed
+// repositories, Step is the step that failed (ex. "clone" or "push"), and Stderr is
+// the error output of git, if it was what failed. Repositories that were never
+// started (because an earlier one failed) are "skipped". Duration is in milliseconds
+type RepoResult struct {
+	Repo     string `json:"repo"`
+	Status   string `json:"status"`
+	Step     string `json:"step,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	Duration int64  `json:"duration"`
+}
+
+// StepError is the failure of a single step of an action in a repository
+type StepError struct {
+	Step   string
+	Stderr string
+	Err    error
+}
+
+func (e *StepError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("Failed to %s: %s: %s", e.Step, e.Err, e.Stderr)
+	}
+
+	return fmt.Sprintf("Failed to %s: %s", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// RepoError is the failure of an action in a repository. Err is usually a
+// StepError, to tell which step of the action failed
+type RepoError struct {
+	Repo string
+	Err  error
+}
+
+func (e *RepoError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Repo, e.Err)
+}
+
+func (e *RepoError) Unwrap() error {
+	return e.Err
+}
+
+// newStepError attributes err to a step. If a command failed, its error output is
+// kept. Errors that already belong to a step are returned as is
+func newStepError(step string, err error) error {
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return err
+	}
+
+	stepErr = &StepError{Step: step, Err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		stepErr.Stderr = strings.TrimSpace(string(exitErr.Stderr))
+	}
+
+	return stepErr
+}
+
+// checkWorkTree makes sure that dir is the top of a git work tree, before git is
+// run in it as a step of an action. Otherwise, 'git -C' would run in the working
+// directory of the server (if dir is empty), or in a repository that contains dir
+func checkWorkTree(step string, dir string) error {
+	if dir == "" {
+		return &StepError{Step: step, Err: fmt.Errorf("Repository has not been cloned")}
+	}
+
+	output, err := gitStep(step, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+
+	top, err := filepath.EvalSymlinks(strings.TrimSpace(output))
+	if err != nil {
+		return newStepError(step, err)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return newStepError(step, err)
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return newStepError(step, err)
+	}
+
+	if top != abs {
+		return &StepError{Step: step, Err: fmt.Errorf("%s is not the top of a git work tree", dir)}
+	}
+
+	return nil
+}
+
+// gitStep runs git in a repository as a step of an action, and returns its output
+func gitStep(step string, dir string, args ...string) (string, error) {
+	if dir == "" {
+		return "", &StepError{Step: step, Err: fmt.Errorf("Repository has not been cloned")}
+	}
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", newStepError(step, err)
+	}
+
+	return string(output), nil
+}
+
+type repoOutcome[T any] struct {
+	value  T
+	result RepoResult
+}
+
+// runRepos is like mapRepos, but also records the outcome of every repository. If
+// continueOnError is true, a failing repository does not stop the others, and its
+// error is only recorded; the returned error is then only about the transaction
+// as a whole
+func runRepos[T any](g *Guardian, transactionName string, continueOnError bool, fn func(transaction *store.Transaction, repo *store.Repo) (T, error)) ([]T, []RepoResult, error) {
+	transaction, err := findTransaction(g, transactionName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outcomes, runErr := mapTransaction(g, transaction, func(transaction *store.Transaction, repo *store.Repo) (repoOutcome[T], error) {
+		start := time.Now()
+		value, err := fn(transaction, repo)
+
+		result := RepoResult{
+			Repo:     repo.Name,
+			Status:   RepoSucceeded,
+			Duration: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			g.logger.Error(fmt.Sprintf("%s: %s", repo.Name, err))
+			if err := g.store.RepoUpdate(transaction.Name, repo.Name, func(r *store.Repo) {
+				r.URL = repo.URL
+				r.Dir = repo.Dir
+				r.Status = store.StatusFailed
+				r.Error = err.Error()
+			}); err != nil {
+				g.logger.Error(fmt.Sprintf("Failed to record that %s failed: %s", repo.Name, err))
+			}
+
+			result.Status = RepoFailed
+			result.Error = err.Error()
+			var stepErr *StepError
+			if errors.As(err, &stepErr) {
+				result.Step = stepErr.Step
+				result.Stderr = stepErr.Stderr
+				result.Error = stepErr.Err.Error()
+			}
+
+			if continueOnError {
+				err = nil
+			}
+		}
+
+		return repoOutcome[T]{value: value, result: result}, err
+	})
+	values := make([]T, len(outcomes))
+	results := make([]RepoResult, len(outcomes))
+	for i, outcome := range outcomes {
+		values[i] = outcome.value
+		results[i] = outcome.result
+		if results[i].Repo == "" {
+			results[i] = RepoResult{
+				Repo:   transaction.Repos[i].Name,
+				Status: RepoSkipped,
+			}
+		}
+	}
+
+	return values, results, runErr
+}
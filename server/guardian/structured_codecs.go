@@ -0,0 +1,753 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// A structuredCodec converts a document to and from the node tree that
+// structured-edit operations work on. Codecs remember what they can of the
+// formatting of the document they decoded, so it can be reproduced when encoding
+type structuredCodec interface {
+	Decode(content []byte) (*yaml.Node, error)
+	Encode(root *yaml.Node) ([]byte, error)
+}
+
+// detectIndent returns the whitespace used to indent the first indented line
+func detectIndent(content []byte, fallback string) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || len(trimmed) == len(line) {
+			continue
+		}
+
+		return line[:len(line)-len(trimmed)]
+	}
+
+	return fallback
+}
+
+type jsonCodec struct {
+	indent          string
+	compact         bool
+	trailingNewline bool
+}
+
+// jsonToNode builds a node from the next value of the decoder. Numbers keep their
+// original text. If source (the decoder's input) is given, containers that are on
+// one line in it get the flow style
+func jsonToNode(decoder *json.Decoder, source []byte) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		start := decoder.InputOffset()
+
+		var node *yaml.Node
+		if t == '{' {
+			node = newMappingNode()
+		} else {
+			node = newSequenceNode()
+		}
+
+		for decoder.More() {
+			if t == '{' {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, newKeyNode(keyToken.(string)))
+			}
+
+			child, err := jsonToNode(decoder, source)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+
+		// Consume the closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		if source != nil && bytes.IndexByte(source[start:decoder.InputOffset()], '\n') == -1 {
+			node.Style = yaml.FlowStyle
+		}
+
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(t), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(t)}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+
+	return nil, fmt.Errorf("Unexpected JSON token: %v", token)
+}
+
+// parseJSONNode parses a JSON value. If keepFlow is true, containers that are on
+// one line get the flow style
+func parseJSONNode(content []byte, keepFlow bool) (*yaml.Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var source []byte
+	if keepFlow {
+		source = content
+	}
+
+	node, err := jsonToNode(decoder, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Unexpected content after JSON value")
+	}
+
+	return node, nil
+}
+
+func (c *jsonCodec) Decode(content []byte) (*yaml.Node, error) {
+	trimmed := bytes.TrimSpace(content)
+	c.compact = !bytes.Contains(trimmed, []byte("\n"))
+	c.indent = detectIndent(trimmed, "  ")
+	c.trailingNewline = bytes.HasSuffix(content, []byte("\n"))
+
+	return parseJSONNode(content, !c.compact)
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+
+	// Encode always appends a newline
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// writeNode writes node as JSON. Containers with the flow style (and everything
+// in them) are written on one line
+func (c *jsonCodec) writeNode(buf *bytes.Buffer, node *yaml.Node, depth int, flow bool) error {
+	flow = flow || node.Style == yaml.FlowStyle
+
+	// separator is written after the opening delimiter, between items, and before
+	// the closing delimiter
+	separator := func(depth int, between bool) {
+		if c.compact {
+			return
+		}
+
+		if flow {
+			if between {
+				buf.WriteByte(' ')
+			}
+			return
+		}
+
+		buf.WriteByte('\n')
+		buf.WriteString(strings.Repeat(c.indent, depth))
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return c.writeNode(buf, node.Alias, depth, flow)
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close := "[", "]"
+		if node.Kind == yaml.MappingNode {
+			open, close = "{", "}"
+		}
+
+		buf.WriteString(open)
+		if len(node.Content) == 0 {
+			buf.WriteString(close)
+			return nil
+		}
+
+		step := 1
+		if node.Kind == yaml.MappingNode {
+			step = 2
+		}
+
+		for i := 0; i < len(node.Content); i += step {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			separator(depth+1, i > 0)
+
+			if node.Kind == yaml.MappingNode {
+				if err := writeJSONString(buf, node.Content[i].Value); err != nil {
+					return err
+				}
+				buf.WriteByte(':')
+				if !c.compact {
+					buf.WriteByte(' ')
+				}
+			}
+
+			if err := c.writeNode(buf, node.Content[i+step-1], depth+1, flow); err != nil {
+				return err
+			}
+		}
+
+		separator(depth, false)
+		buf.WriteString(close)
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!null":
+			buf.WriteString(node.Value)
+		default:
+			return writeJSONString(buf, node.Value)
+		}
+	default:
+		return fmt.Errorf("Unable to write node of kind %v as JSON", node.Kind)
+	}
+
+	return nil
+}
+
+func (c *jsonCodec) Encode(root *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.writeNode(&buf, root, 0, false); err != nil {
+		return nil, err
+	}
+
+	if c.trailingNewline {
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Only the first document of a multi-document stream is edited; the rest are
+// written back unchanged
+type yamlCodec struct {
+	indent        int
+	explicitStart bool
+	documents     []*yaml.Node
+
+	// Top-level keys with a blank line above them, which the encoder does not keep
+	spaced map[string]bool
+}
+
+// yamlKeyLine returns the line of a key, or of the start of its head comment
+func yamlKeyLine(key *yaml.Node) int {
+	line := key.Line
+	if key.HeadComment != "" {
+		line -= strings.Count(key.HeadComment, "\n") + 1
+	}
+
+	return line
+}
+
+// yamlSpacedKeys returns the top-level keys of the first document that have a
+// blank line above them
+func yamlSpacedKeys(document *yaml.Node, content []byte) map[string]bool {
+	spaced := map[string]bool{}
+	lines := strings.Split(string(content), "\n")
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode || root.Style == yaml.FlowStyle {
+		return spaced
+	}
+
+	for i := 2; i < len(root.Content); i += 2 {
+		line := yamlKeyLine(root.Content[i])
+		if line >= 2 && line-2 < len(lines) && strings.TrimSpace(lines[line-2]) == "" {
+			spaced[root.Content[i].Value] = true
+		}
+	}
+
+	return spaced
+}
+
+func (c *yamlCodec) Decode(content []byte) (*yaml.Node, error) {
+	c.indent = len(detectIndent(content, "  "))
+	c.explicitStart = bytes.HasPrefix(content, []byte("---"))
+	c.documents = []*yaml.Node{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		c.documents = append(c.documents, &document)
+	}
+
+	if len(c.documents) == 0 || len(c.documents[0].Content) == 0 {
+		return nil, fmt.Errorf("YAML document is empty")
+	}
+	c.spaced = yamlSpacedKeys(c.documents[0], content)
+
+	return c.documents[0].Content[0], nil
+}
+
+func (c *yamlCodec) Encode(root *yaml.Node) ([]byte, error) {
+	c.documents[0].Content[0] = root
+
+	var buf bytes.Buffer
+	if c.explicitStart {
+		buf.WriteString("---\n")
+	}
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(c.indent)
+	for _, document := range c.documents {
+		if err := encoder.Encode(document); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return c.addBlankLines(buf.Bytes())
+}
+
+// addBlankLines puts back the blank lines above top-level keys, which are found by
+// decoding the encoded document again
+func (c *yamlCodec) addBlankLines(content []byte) ([]byte, error) {
+	if len(c.spaced) == 0 {
+		return content, nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return content, nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i := len(root.Content) - 2; i >= 2; i -= 2 {
+		line := yamlKeyLine(root.Content[i])
+		if !c.spaced[root.Content[i].Value] || line < 2 || strings.TrimSpace(lines[line-2]) == "" {
+			continue
+		}
+
+		lines = append(lines[:line-1], append([]string{""}, lines[line-1:]...)...)
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// TOML documents are edited line by line, so comments and formatting are kept for
+// everything but the values that changed. Changes that cannot be made that way
+// (like turning a value into a table) re-serialize the document, keeping key order
+// and the choice between inline tables and [table] headers, but not comments.
+// Mappings with a flow style are written inline
+type tomlCodec struct {
+	lines    []string
+	original *yaml.Node
+
+	// Tables with a header of their own. The others, like "tool" of [tool.black],
+	// only exist because of the header of a subtable
+	headers map[string]bool
+}
+
+var (
+	tomlHeaderRegex  = regexp.MustCompile(`(?m)^[ \t]*(\[\[?)([^\[\]]+)\]\]?[ \t]*(#.*)?$`)
+	tomlBareKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// splitTomlKey splits a dotted key, taking quoted parts into account
+func splitTomlKey(key string) []string {
+	parts := []string{}
+	current := strings.Builder{}
+	quote := byte(0)
+
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteByte(ch)
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '.':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		case ch != ' ' && ch != '\t':
+			current.WriteByte(ch)
+		}
+	}
+
+	return append(parts, strings.TrimSpace(current.String()))
+}
+
+func tomlValueToNode(value interface{}, path string, order map[string]int, headers map[string]bool) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		node := newMappingNode()
+		if !headers[path] {
+			node.Style = yaml.FlowStyle
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		childPath := func(key string) string {
+			if path == "" {
+				return key
+			}
+
+			return path + "." + key
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return order[childPath(keys[i])] < order[childPath(keys[j])]
+		})
+
+		for _, key := range keys {
+			child, err := tomlValueToNode(v[key], childPath(key), order, headers)
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, newKeyNode(key), child)
+		}
+
+		return node, nil
+	case []map[string]interface{}:
+		node := newSequenceNode()
+		for _, item := range v {
+			child, err := tomlValueToNode(item, path, order, headers)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+
+		return node, nil
+	case []interface{}:
+		node := newSequenceNode()
+		for _, item := range v {
+			child, err := tomlValueToNode(item, path, order, map[string]bool{})
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v, 10)}, nil
+	case float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: formatTomlFloat(v)}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}, nil
+	case time.Time:
+		layout := time.RFC3339Nano
+		switch v.Location().String() {
+		case "datetime-local":
+			layout = "2006-01-02T15:04:05.999999999"
+		case "date-local":
+			layout = "2006-01-02"
+		case "time-local":
+			layout = "15:04:05.999999999"
+		}
+
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: v.Format(layout)}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported TOML value: %v", value)
+}
+
+func formatTomlFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s
+}
+
+func (c *tomlCodec) Decode(content []byte) (*yaml.Node, error) {
+	var data map[string]interface{}
+	metadata, err := toml.Decode(string(content), &data)
+	if err != nil {
+		return nil, err
+	}
+
+	order := map[string]int{}
+	for i, key := range metadata.Keys() {
+		if _, ok := order[key.String()]; !ok {
+			order[key.String()] = i
+		}
+	}
+
+	headers := map[string]bool{"": true}
+	prefixes := []string{}
+	for _, match := range tomlHeaderRegex.FindAllSubmatch(content, -1) {
+		parts := splitTomlKey(string(match[2]))
+		headers[strings.Join(parts, ".")] = true
+		for i := 1; i < len(parts); i++ {
+			prefixes = append(prefixes, strings.Join(parts[:i], "."))
+		}
+	}
+
+	// Implicit tables are not inline tables, but they do not have a header either
+	c.headers = headers
+	tables := map[string]bool{}
+	for path := range headers {
+		tables[path] = true
+	}
+	for _, path := range prefixes {
+		tables[path] = true
+	}
+
+	root, err := tomlValueToNode(data, "", order, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lines = strings.Split(string(content), "\n")
+	c.original = copyNode(root)
+
+	return root, nil
+}
+
+func writeTomlKey(buf *bytes.Buffer, key string) error {
+	if tomlBareKeyRegex.MatchString(key) {
+		buf.WriteString(key)
+		return nil
+	}
+
+	return writeJSONString(buf, key)
+}
+
+// isTomlTableArray reports whether node should be written as an array of tables
+func isTomlTableArray(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode || item.Style == yaml.FlowStyle {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeTomlInline(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return writeTomlInline(buf, node.Alias)
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+
+		buf.WriteString("{ ")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeTomlKey(buf, node.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteString(" = ")
+			if err := writeTomlInline(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(" }")
+	case yaml.SequenceNode:
+		buf.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := writeTomlInline(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!int", "!!bool", "!!timestamp":
+			buf.WriteString(node.Value)
+		case "!!float":
+			f, err := strconv.ParseFloat(node.Value, 64)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(formatTomlFloat(f))
+		case "!!null":
+			return fmt.Errorf("TOML has no null value")
+		default:
+			return writeJSONString(buf, node.Value)
+		}
+	}
+
+	return nil
+}
+
+func (c *tomlCodec) writeTable(buf *bytes.Buffer, node *yaml.Node, path []string) error {
+	type deferred struct {
+		key   string
+		value *yaml.Node
+	}
+	tables := []deferred{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+
+		if isTomlTable(value) {
+			tables = append(tables, deferred{key: key, value: value})
+			continue
+		}
+
+		if err := writeTomlKey(buf, key); err != nil {
+			return err
+		}
+		buf.WriteString(" = ")
+		if err := writeTomlInline(buf, value); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	}
+
+	for _, table := range tables {
+		if err := c.writeTableEntry(buf, append(append([]string{}, path...), table.key), table.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isTomlTable reports whether node should be written as a table (or an array of
+// tables) under its own header, rather than inline
+func isTomlTable(node *yaml.Node) bool {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return (node.Kind == yaml.MappingNode && node.Style != yaml.FlowStyle) || isTomlTableArray(node)
+}
+
+// writeTomlHeader writes the dotted key of a table header
+func writeTomlHeader(buf *bytes.Buffer, path []string) error {
+	for i, part := range path {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		if err := writeTomlKey(buf, part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTableEntry writes a table, or each table of an array of tables, under its
+// header. Tables that only hold other tables are written without one, unless they
+// had one in the original document
+func (c *tomlCodec) writeTableEntry(buf *bytes.Buffer, path []string, value *yaml.Node) error {
+	var header bytes.Buffer
+	if err := writeTomlHeader(&header, path); err != nil {
+		return err
+	}
+
+	items := []*yaml.Node{value}
+	open, close := "[", "]"
+	if value.Kind == yaml.SequenceNode {
+		items = value.Content
+		open, close = "[[", "]]"
+	}
+
+	for _, item := range items {
+		if value.Kind == yaml.SequenceNode || c.headers[strings.Join(path, ".")] || hasTomlKeys(item) || len(item.Content) == 0 {
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.WriteString(open + header.String() + close + "\n")
+		}
+
+		if err := c.writeTable(buf, item, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasTomlKeys reports whether a table has keys that are written under its header,
+// rather than as tables of their own
+func hasTomlKeys(node *yaml.Node) bool {
+	for i := 1; i < len(node.Content); i += 2 {
+		if !isTomlTable(node.Content[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *tomlCodec) Encode(root *yaml.Node) ([]byte, error) {
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("TOML document must be a table")
+	}
+
+	if content, ok := c.editLines(root); ok {
+		return content, nil
+	}
+
+	var buf bytes.Buffer
+	if err := c.writeTable(&buf, root, []string{}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,555 @@
+package manager
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Editing TOML line by line: the original document is split into sections (the
+// root table and each [table] or [[table]] header, up to the next one), and the
+// key/value entries within them. The decoded tree is compared with the edited one,
+// and only the lines of what changed are replaced, removed, or added
+
+var tomlEntryRegex = regexp.MustCompile(`^[ \t]*((?:"[^"]*"|'[^']*'|[A-Za-z0-9_-]+)(?:[ \t]*\.[ \t]*(?:"[^"]*"|'[^']*'|[A-Za-z0-9_-]+))*)[ \t]*=[ \t]*`)
+
+// The lines of a section are [first, end), where first is the start of the
+// comments right above its header (unless they start the document)
+type tomlSection struct {
+	path    string
+	array   bool
+	first   int
+	start   int // The line of the header, or -1 for the root table
+	end     int
+	entries []tomlEntry
+}
+
+// tomlEntry is a key/value pair, which spans the lines [start, end)
+type tomlEntry struct {
+	key    []string
+	start  int
+	end    int
+	prefix string // Everything before the value, on the first line
+	suffix string // Everything after the value (like a comment), on the last line
+}
+
+type tomlEditor struct {
+	codec    *tomlCodec
+	sections []*tomlSection
+
+	// The lines that replace each original line, and those before the first one
+	out  [][]string
+	head []string
+
+	// Tables that were not in the original document, written at its end
+	appended bytes.Buffer
+	pending  string
+}
+
+// copyNode returns a deep copy of node
+func copyNode(node *yaml.Node) *yaml.Node {
+	result := *node
+	result.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		result.Content[i] = copyNode(child)
+	}
+
+	return &result
+}
+
+// tomlNodesEqual reports whether a and b would be written the same way
+func tomlNodesEqual(a, b *yaml.Node) bool {
+	if a.Kind == yaml.AliasNode {
+		a = a.Alias
+	}
+	if b.Kind == yaml.AliasNode {
+		b = b.Alias
+	}
+
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+
+	switch a.Kind {
+	case yaml.ScalarNode:
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	case yaml.MappingNode:
+		if (a.Style == yaml.FlowStyle) != (b.Style == yaml.FlowStyle) {
+			return false
+		}
+	}
+
+	for i := range a.Content {
+		if !tomlNodesEqual(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tomlMultilineEnd returns the position just after the end of a multi-line string
+// delimited by delim, which starts before lines[line][col]
+func tomlMultilineEnd(lines []string, line int, col int, delim string) (int, int, bool) {
+	for ; line < len(lines); line, col = line+1, 0 {
+		s := lines[line]
+		for col < len(s) {
+			if delim == `"""` && s[col] == '\\' {
+				col += 2
+				continue
+			}
+
+			if strings.HasPrefix(s[col:], delim) {
+				// Up to two quotes may come right before the delimiter
+				end := col + len(delim)
+				for i := 0; i < 2 && end < len(s) && s[end] == delim[0]; i++ {
+					end++
+				}
+
+				return line, end, true
+			}
+
+			col++
+		}
+	}
+
+	return 0, 0, false
+}
+
+// tomlValueEnd returns the position just after the value that starts at
+// lines[line][col]. Arrays, inline tables, and multi-line strings may span several
+// lines
+func tomlValueEnd(lines []string, line int, col int) (int, int, bool) {
+	depth := 0
+	end := col
+
+	for line < len(lines) {
+		s := lines[line]
+		for col < len(s) {
+			ch := s[col]
+			switch {
+			case ch == ' ' || ch == '\t' || ch == '\r':
+				col++
+				continue
+			case ch == '#':
+				col = len(s)
+				continue
+			case strings.HasPrefix(s[col:], `"""`) || strings.HasPrefix(s[col:], `'''`):
+				closeLine, closeCol, ok := tomlMultilineEnd(lines, line, col+3, s[col:col+3])
+				if !ok {
+					return 0, 0, false
+				}
+				line, col, s = closeLine, closeCol, lines[closeLine]
+			case ch == '"' || ch == '\'':
+				i := col + 1
+				for i < len(s) && s[i] != ch {
+					if ch == '"' && s[i] == '\\' {
+						i++
+					}
+					i++
+				}
+				if i >= len(s) {
+					return 0, 0, false
+				}
+				col = i + 1
+			case ch == '[' || ch == '{':
+				depth++
+				col++
+			case ch == ']' || ch == '}':
+				depth--
+				col++
+			default:
+				col++
+			}
+
+			end = col
+		}
+
+		if depth <= 0 {
+			return line, end, true
+		}
+
+		line, col = line+1, 0
+	}
+
+	return 0, 0, false
+}
+
+// parseTomlLines splits a document into sections. It fails on lines it does not
+// understand, in which case the document is not edited line by line
+func parseTomlLines(lines []string) ([]*tomlSection, bool) {
+	current := &tomlSection{start: -1}
+	sections := []*tomlSection{current}
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if matches := tomlHeaderRegex.FindStringSubmatch(lines[i]); matches != nil {
+			first := i
+			for first > 0 && strings.HasPrefix(strings.TrimSpace(lines[first-1]), "#") {
+				first--
+			}
+
+			// Comments at the start of the document are about the document, and
+			// not the table
+			if strings.TrimSpace(strings.Join(lines[:first], "")) == "" {
+				first = i
+			}
+
+			current.end = first
+			current = &tomlSection{
+				path:  strings.Join(splitTomlKey(matches[2]), "."),
+				array: matches[1] == "[[",
+				first: first,
+				start: i,
+			}
+			sections = append(sections, current)
+			continue
+		}
+
+		matches := tomlEntryRegex.FindStringSubmatchIndex(lines[i])
+		if matches == nil {
+			return nil, false
+		}
+
+		line, col, ok := tomlValueEnd(lines, i, matches[1])
+		if !ok {
+			return nil, false
+		}
+
+		current.entries = append(current.entries, tomlEntry{
+			key:    splitTomlKey(lines[i][matches[2]:matches[3]]),
+			start:  i,
+			end:    line + 1,
+			prefix: lines[i][:matches[1]],
+			suffix: lines[line][col:],
+		})
+		i = line
+	}
+	current.end = len(lines)
+
+	return sections, true
+}
+
+// editLines applies the changes from the decoded document to root by editing the
+// lines of the original document. It reports false if that is not possible
+func (c *tomlCodec) editLines(root *yaml.Node) ([]byte, bool) {
+	if c.original == nil {
+		return nil, false
+	}
+
+	sections, ok := parseTomlLines(c.lines)
+	if !ok {
+		return nil, false
+	}
+
+	e := &tomlEditor{codec: c, sections: sections, out: make([][]string, len(c.lines))}
+	for i, line := range c.lines {
+		e.out[i] = []string{line}
+	}
+
+	if !e.editTable([]string{}, c.original, root) {
+		return nil, false
+	}
+
+	lines := append([]string{}, e.head...)
+	for _, replacement := range e.out {
+		lines = append(lines, replacement...)
+	}
+	content := strings.Join(lines, "\n")
+
+	if e.appended.Len() > 0 {
+		content = strings.TrimRight(content, "\n")
+		if content != "" {
+			content += "\n\n"
+		}
+		content += e.appended.String()
+	}
+
+	return []byte(content), true
+}
+
+func (e *tomlEditor) section(path []string) *tomlSection {
+	key := strings.Join(path, ".")
+	for _, section := range e.sections {
+		if section.path == key && !section.array && (section.start != -1 || len(path) == 0) {
+			return section
+		}
+	}
+
+	return nil
+}
+
+func (e *tomlEditor) remove(start int, end int) {
+	for i := start; i < end; i++ {
+		e.out[i] = nil
+	}
+}
+
+// editTable edits the lines of the table at path so that it matches node, rather
+// than old. Keys are edited before subtables, as the former come first
+func (e *tomlEditor) editTable(path []string, old *yaml.Node, node *yaml.Node) bool {
+	section := e.section(path)
+	childPath := func(key string) []string {
+		return append(append([]string{}, path...), key)
+	}
+
+	for i := 0; i+1 < len(old.Content); i += 2 {
+		key := old.Content[i].Value
+		if mappingValue(node, key) == -1 && !e.removeKey(section, childPath(key), old.Content[i+1]) {
+			return false
+		}
+	}
+
+	tables := []int{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+
+		var oldValue *yaml.Node
+		if j := mappingValue(old, key); j != -1 {
+			oldValue = old.Content[j]
+		}
+
+		switch {
+		case oldValue != nil && tomlNodesEqual(oldValue, value):
+		case isTomlTable(value):
+			tables = append(tables, i)
+		case oldValue != nil && isTomlTable(oldValue):
+			return false
+		case !e.setKey(path, section, key, oldValue, value):
+			return false
+		}
+	}
+
+	for _, i := range tables {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+
+		j := mappingValue(old, key)
+		if j == -1 {
+			if err := e.codec.writeTableEntry(&e.appended, childPath(key), value); err != nil {
+				return false
+			}
+			e.pending = ""
+			continue
+		}
+		oldValue := old.Content[j]
+
+		switch {
+		case value.Kind == yaml.MappingNode && oldValue.Kind == yaml.MappingNode && oldValue.Style != yaml.FlowStyle:
+			if !e.editTable(childPath(key), oldValue, value) {
+				return false
+			}
+		case value.Kind == yaml.SequenceNode && isTomlTableArray(oldValue) && isTomlPrefix(oldValue, value):
+			// Tables appended to an array of tables are written at the end, which
+			// keeps their order
+			added := &yaml.Node{Kind: yaml.SequenceNode, Content: value.Content[len(oldValue.Content):]}
+			if err := e.codec.writeTableEntry(&e.appended, childPath(key), added); err != nil {
+				return false
+			}
+			e.pending = ""
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// isTomlPrefix reports whether the items of the array old start the array node
+func isTomlPrefix(old *yaml.Node, node *yaml.Node) bool {
+	if len(old.Content) > len(node.Content) {
+		return false
+	}
+
+	for i, item := range old.Content {
+		if !tomlNodesEqual(item, node.Content[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removeKey removes the lines of a key that is no longer in its table
+func (e *tomlEditor) removeKey(section *tomlSection, path []string, old *yaml.Node) bool {
+	if isTomlTable(old) {
+		prefix := strings.Join(path, ".")
+		for _, s := range e.sections {
+			if s.start != -1 && (s.path == prefix || strings.HasPrefix(s.path, prefix+".")) {
+				e.remove(s.first, s.end)
+			}
+		}
+
+		return true
+	}
+
+	if section == nil {
+		return false
+	}
+
+	// Dotted keys, like "key.subkey = value", are removed along with the key
+	found := false
+	for _, entry := range section.entries {
+		if entry.key[0] == path[len(path)-1] {
+			e.remove(entry.start, entry.end)
+			found = true
+		}
+	}
+
+	return found
+}
+
+// setKey replaces the value of a key of the table at path, or adds the key
+func (e *tomlEditor) setKey(path []string, section *tomlSection, key string, old *yaml.Node, value *yaml.Node) bool {
+	var buf bytes.Buffer
+	if err := writeTomlInline(&buf, value); err != nil {
+		return false
+	}
+
+	if old != nil {
+		if section == nil {
+			return false
+		}
+
+		for _, entry := range section.entries {
+			if len(entry.key) != 1 || entry.key[0] != key {
+				continue
+			}
+
+			if e.appendItems(entry, old, value) {
+				return true
+			}
+
+			e.remove(entry.start, entry.end)
+			e.out[entry.start] = []string{entry.prefix + buf.String() + entry.suffix}
+			return true
+		}
+
+		// The value is set with dotted keys
+		return false
+	}
+
+	var line bytes.Buffer
+	if err := writeTomlKey(&line, key); err != nil {
+		return false
+	}
+	line.WriteString(" = ")
+	line.Write(buf.Bytes())
+
+	switch {
+	case section == nil:
+		// Implicit tables, like "tool" of [tool.black], get a header of their own
+		name := strings.Join(path, ".")
+		if e.pending != name {
+			if e.appended.Len() > 0 {
+				e.appended.WriteByte('\n')
+			}
+			e.appended.WriteByte('[')
+			if err := writeTomlHeader(&e.appended, path); err != nil {
+				return false
+			}
+			e.appended.WriteString("]\n")
+			e.pending = name
+		}
+		e.appended.WriteString(line.String() + "\n")
+	case len(section.entries) > 0:
+		last := section.entries[len(section.entries)-1]
+		indent := last.prefix[:len(last.prefix)-len(strings.TrimLeft(last.prefix, " \t"))]
+		e.out[last.end-1] = append(e.out[last.end-1], indent+line.String())
+	case section.start != -1:
+		e.out[section.start] = append(e.out[section.start], line.String())
+	default:
+		// The root table has no keys, so the key goes before the first header
+		lines := []string{line.String()}
+		if len(e.sections) > 1 {
+			lines = append(lines, "")
+		}
+
+		if strings.TrimSpace(strings.Join(e.codec.lines[:section.end], "")) == "" {
+			e.head = append(e.head, lines...)
+		} else {
+			e.out[section.end-1] = append(e.out[section.end-1], lines...)
+		}
+	}
+
+	return true
+}
+
+// appendItems adds items that were appended to an array written over several
+// lines, with one item per line, before its closing bracket
+func (e *tomlEditor) appendItems(entry tomlEntry, old *yaml.Node, value *yaml.Node) bool {
+	if old.Kind != yaml.SequenceNode || value.Kind != yaml.SequenceNode || len(old.Content) == 0 || !isTomlPrefix(old, value) {
+		return false
+	}
+
+	closing := entry.end - 1
+	if closing == entry.start || !strings.HasPrefix(strings.TrimSpace(e.codec.lines[closing]), "]") {
+		return false
+	}
+
+	for _, item := range old.Content {
+		if item.Kind != yaml.ScalarNode || strings.Contains(item.Value, "\n") {
+			return false
+		}
+	}
+
+	// The last line with an item must end with a comma
+	last := closing - 1
+	for last > entry.start && tomlCodeEnd(e.codec.lines[last]) == 0 {
+		last--
+	}
+	if last == entry.start {
+		return false
+	}
+	line := e.codec.lines[last]
+	end := tomlCodeEnd(line)
+	if line[end-1] != ',' {
+		e.out[last] = []string{line[:end] + "," + line[end:]}
+	}
+
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	for _, item := range value.Content[len(old.Content):] {
+		var buf bytes.Buffer
+		if err := writeTomlInline(&buf, item); err != nil {
+			return false
+		}
+		e.out[closing-1] = append(e.out[closing-1], indent+buf.String()+",")
+	}
+
+	return true
+}
+
+// tomlCodeEnd returns the position just after the last character of a line that
+// is not whitespace or a comment
+func tomlCodeEnd(line string) int {
+	end := 0
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '#':
+			return end
+		case ch == '"' || ch == '\'':
+			for i++; i < len(line) && line[i] != ch; i++ {
+				if ch == '"' && line[i] == '\\' {
+					i++
+				}
+			}
+			end = i + 1
+		case ch != ' ' && ch != '\t' && ch != '\r':
+			end = i + 1
+		}
+	}
+
+	if end > len(line) {
+		return len(line)
+	}
+
+	return end
+}
@@ -0,0 +1,165 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// RepoSummary summarizes what applying a transaction did to one repository. Status
+// is "changed", "unchanged", or "errored"
+type RepoSummary struct {
+	Repo    string   `json:"repo"`
+	Status  string   `json:"status"`
+	Files   []string `json:"files"`
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+	Errors  []string `json:"errors"`
+}
+
+// Summary summarizes what applying a transaction did to all of its repositories
+type Summary struct {
+	Transaction string        `json:"transaction"`
+	Repos       []RepoSummary `json:"repos"`
+	Changed     int           `json:"changed"`
+	Unchanged   int           `json:"unchanged"`
+	Errored     int           `json:"errored"`
+	Files       int           `json:"files"`
+	Added       int           `json:"added"`
+	Removed     int           `json:"removed"`
+}
+
+// summarize builds a summary of the result of applying a transaction
+func summarize(transaction store.Transaction, result ApplyResult) Summary {
+	summary := Summary{
+		Transaction: transaction.Name,
+		Repos:       []RepoSummary{},
+	}
+
+	diffs := map[string]RepoDiff{}
+	for _, diff := range result.Diffs {
+		diffs[diff.Repo] = diff
+	}
+
+	for _, repo := range transaction.Repos {
+		repoSummary := RepoSummary{
+			Repo:   repo.Name,
+			Status: "unchanged",
+			Files:  []string{},
+			Errors: []string{},
+		}
+
+		if diff, ok := diffs[repo.Name]; ok {
+			for _, file := range diff.Files {
+				repoSummary.Files = append(repoSummary.Files, file.Path)
+			}
+			repoSummary.Added = diff.Added
+			repoSummary.Removed = diff.Removed
+		}
+
+		for _, failure := range result.Errors {
+			if failure.Repo == repo.Name {
+				repoSummary.Errors = append(repoSummary.Errors, fmt.Sprintf("%s: %s", failure.Transformer, failure.Error))
+			}
+		}
+
+		// Failing transformers are already listed above
+		for _, r := range result.Repos {
+			if r.Repo != repo.Name || r.Status != RepoFailed || r.Step == "transform" {
+				continue
+			}
+
+			message := r.Error
+			if r.Stderr != "" {
+				message = fmt.Sprintf("%s: %s", message, r.Stderr)
+			}
+			if r.Step != "" {
+				message = fmt.Sprintf("%s: %s", r.Step, message)
+			}
+			repoSummary.Errors = append(repoSummary.Errors, message)
+		}
+
+		switch {
+		case len(repoSummary.Errors) > 0:
+			repoSummary.Status = "errored"
+			summary.Errored++
+		case len(repoSummary.Files) > 0:
+			repoSummary.Status = "changed"
+			summary.Changed++
+		default:
+			summary.Unchanged++
+		}
+
+		summary.Files += len(repoSummary.Files)
+		summary.Added += repoSummary.Added
+		summary.Removed += repoSummary.Removed
+		summary.Repos = append(summary.Repos, repoSummary)
+	}
+
+	return summary
+}
+
+// FormatSummary renders a summary as "table", "json", or "markdown"
+func FormatSummary(summary Summary, format string) (string, error) {
+	switch format {
+	case "json":
+		text, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return "", err
+		}
+
+		return string(text), nil
+	case "", "table":
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "REPO\tSTATUS\tFILES\tADDED\tREMOVED")
+		for _, repo := range summary.Repos {
+			fmt.Fprintf(w, "%s\t%s\t%d\t+%d\t-%d\n", repo.Repo, repo.Status, len(repo.Files), repo.Added, repo.Removed)
+		}
+		fmt.Fprintf(w, "TOTAL\t\t%d\t+%d\t-%d\n", summary.Files, summary.Added, summary.Removed)
+		if err := w.Flush(); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&buf, "\n%d changed, %d unchanged, %d errored\n", summary.Changed, summary.Unchanged, summary.Errored)
+
+		for _, repo := range summary.Repos {
+			for _, e := range repo.Errors {
+				fmt.Fprintf(&buf, "\n%s: %s", repo.Repo, e)
+			}
+		}
+
+		return strings.TrimRight(buf.String(), "\n"), nil
+	case "markdown":
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "## %s\n\n", summary.Transaction)
+		fmt.Fprintf(&buf, "%d changed, %d unchanged, %d errored. %d files, +%d -%d\n\n", summary.Changed, summary.Unchanged, summary.Errored, summary.Files, summary.Added, summary.Removed)
+		fmt.Fprintln(&buf, "| Repository | Status | Files | Added | Removed |")
+		fmt.Fprintln(&buf, "| --- | --- | ---: | ---: | ---: |")
+		for _, repo := range summary.Repos {
+			fmt.Fprintf(&buf, "| %s | %s | %d | +%d | -%d |\n", repo.Repo, repo.Status, len(repo.Files), repo.Added, repo.Removed)
+		}
+
+		for _, repo := range summary.Repos {
+			if len(repo.Files) == 0 && len(repo.Errors) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(&buf, "\n### %s\n\n", repo.Repo)
+			for _, file := range repo.Files {
+				fmt.Fprintf(&buf, "- `%s`\n", file)
+			}
+			for _, e := range repo.Errors {
+				fmt.Fprintf(&buf, "- **Error**: %s\n", strings.ReplaceAll(e, "\n", " "))
+			}
+		}
+
+		return strings.TrimRight(buf.String(), "\n"), nil
+	}
+
+	return "", fmt.Errorf("Unknown summary format: %s (must be one of table, json, markdown)", format)
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// templateData is what the content of a templated transformer is rendered with.
+// For a repository named "hyperupcall/redpanda", Owner is "hyperupcall" and Repo
+// is "redpanda"
+type templateData struct {
+	Name          string
+	Owner         string
+	Repo          string
+	Dir           string
+	DefaultBranch string
+	Vars          map[string]string
+}
+
+// defaultBranch returns the branch that origin/HEAD points to, falling back to
+// the currently checked out branch
+func defaultBranch(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	if output, err := cmd.Output(); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(string(output)), "origin/"), nil
+	}
+
+	cmd = exec.Command("git", "-C", dir, "symbolic-ref", "--short", "HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// repoOwner returns the owner part of a repository name like "owner/name"
+func repoOwner(name string) string {
+	if i := strings.Index(name, "/"); i != -1 {
+		return name[:i]
+	}
+
+	return ""
+}
+
+// renderTransformer returns a copy of the transformer, with its content rendered
+// as a text/template if it is marked as a template
+func renderTransformer(transformer store.Transformer, repo *store.Repo) (store.Transformer, error) {
+	if !transformer.Template {
+		return transformer, nil
+	}
+
+	tmpl, err := template.New(transformer.Name).Option("missingkey=error").Parse(transformer.Content)
+	if err != nil {
+		return transformer, fmt.Errorf("Failed to parse template of transformer '%s': %w", transformer.Name, err)
+	}
+
+	branch, err := defaultBranch(repo.Dir)
+	if err != nil {
+		return transformer, err
+	}
+
+	vars := repo.Variables
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	data := templateData{
+		Name:          repo.Name,
+		Owner:         repoOwner(repo.Name),
+		Repo:          path.Base(repo.Name),
+		Dir:           repo.Dir,
+		DefaultBranch: branch,
+		Vars:          vars,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return transformer, fmt.Errorf("Failed to render template of transformer '%s' for %s: %w", transformer.Name, repo.Name, err)
+	}
+
+	transformer.Content = buf.String()
+	return transformer, nil
+}
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// The content of a "comby" transformer is a JSON object of this shape. Language
+// is passed to comby as its matcher (ex. ".go", ".js"); if it is empty, comby
+// infers it from each file's extension
+type combyContent struct {
+	Match    string   `json:"match"`
+	Rewrite  string   `json:"rewrite"`
+	Language string   `json:"language"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+}
+
+// A single line of output from 'comby -json-lines'
+type combyResult struct {
+	URI             string            `json:"uri"`
+	RewrittenSource string            `json:"rewritten_source"`
+	Substitutions   []json.RawMessage `json:"in_place_substitutions"`
+}
+
+func parseCombyContent(content string) (combyContent, error) {
+	var c combyContent
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		return c, fmt.Errorf("Failed to parse comby transformer content: %w", err)
+	}
+
+	if c.Match == "" {
+		return c, fmt.Errorf("Comby transformer must have a match template")
+	}
+
+	return c, nil
+}
+
+// Files are passed to comby in batches, whose paths add up to at most this many
+// bytes, to stay well under the limit of the system on the size of arguments
+const combyBatchSize = 128 * 1024
+
+// combyBatches splits files into batches of at most combyBatchSize bytes (or a
+// single file, if it is longer than that)
+func combyBatches(files []string) [][]string {
+	batches := [][]string{}
+	batch := []string{}
+	size := 0
+
+	for _, file := range files {
+		if len(batch) > 0 && size+len(file)+1 > combyBatchSize {
+			batches = append(batches, batch)
+			batch, size = []string{}, 0
+		}
+
+		batch = append(batch, file)
+		size += len(file) + 1
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+func transformComby(repo *store.Repo, transformer store.Transformer) (TransformerReport, error) {
+	report := TransformerReport{
+		Repo:        repo.Name,
+		Transformer: transformer.Name,
+		Matches:     map[string]int{},
+	}
+
+	c, err := parseCombyContent(transformer.Content)
+	if err != nil {
+		return report, err
+	}
+
+	combyPath, err := exec.LookPath("comby")
+	if err != nil {
+		return report, fmt.Errorf("Failed to find comby executable: %w", err)
+	}
+
+	files, err := transformerFiles(repo, transformer, c.Include, c.Exclude)
+	if err != nil {
+		return report, err
+	}
+
+	for _, batch := range combyBatches(files) {
+		if err := runComby(repo, combyPath, c, batch, &report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// runComby rewrites files with comby, and records the number of matches in each
+func runComby(repo *store.Repo, combyPath string, c combyContent, files []string, report *TransformerReport) error {
+	args := []string{c.Match, c.Rewrite}
+	args = append(args, files...)
+	args = append(args, "-json-lines")
+	if c.Language != "" {
+		args = append(args, "-matcher", c.Language)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(combyPath, args...)
+	cmd.Dir = repo.Dir
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("Failed to run comby: %w: %s", err, stderr.String())
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var result combyResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return fmt.Errorf("Failed to parse comby output: %w", err)
+		}
+
+		path := result.URI
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(repo.Dir, path)
+		}
+
+		file, err := filepath.Rel(repo.Dir, path)
+		if err != nil {
+			return err
+		}
+		report.Matches[file] = len(result.Substitutions)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(path, []byte(result.RewrittenSource), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,618 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// The content of a "dependency" transformer is a JSON object of this shape. Every
+// manifest that depends on the package has its version constraint set to version
+// (as written in the manifest, ex. "^4.17.21" for npm or ">=2.31,<3" for Python).
+// Bare versions are made exact for Go ("v1.2.3") and Python ("==1.2.3"). If
+// ecosystems is empty, manifests of every ecosystem are updated
+type dependencyContent struct {
+	Package      string   `json:"package"`
+	Version      string   `json:"version"`
+	Ecosystems   []string `json:"ecosystems"`
+	SkipLockfile bool     `json:"skipLockfile"`
+	Include      []string `json:"include"`
+	Exclude      []string `json:"exclude"`
+}
+
+// A lockfileTool regenerates a lockfile next to a manifest. It is only run if the
+// lockfile exists, and the executable is installed
+type lockfileTool struct {
+	lockfile string
+	command  func(pkg string) []string
+}
+
+type dependencyEcosystem struct {
+	name      string
+	manifest  func(file string) bool
+	normalize func(version string) string
+	edit      func(file string, content []byte, pkg string, version string) ([]byte, int, error)
+	lockfiles []lockfileTool
+}
+
+var dependencyEcosystems = []dependencyEcosystem{
+	{
+		name: "go",
+		manifest: func(file string) bool {
+			return path.Base(file) == "go.mod"
+		},
+		normalize: func(version string) string {
+			if version != "" && !strings.HasPrefix(version, "v") {
+				return "v" + version
+			}
+			return version
+		},
+		edit: editGoMod,
+		lockfiles: []lockfileTool{
+			{"go.sum", func(pkg string) []string { return []string{"go", "mod", "tidy"} }},
+		},
+	},
+	{
+		name: "npm",
+		manifest: func(file string) bool {
+			return path.Base(file) == "package.json" && !strings.Contains("/"+file, "/node_modules/")
+		},
+		normalize: func(version string) string {
+			return version
+		},
+		edit: editPackageJSON,
+		lockfiles: []lockfileTool{
+			{"package-lock.json", func(pkg string) []string {
+				return []string{"npm", "install", "--package-lock-only", "--ignore-scripts"}
+			}},
+			{"yarn.lock", func(pkg string) []string { return []string{"yarn", "install", "--ignore-scripts"} }},
+			{"pnpm-lock.yaml", func(pkg string) []string {
+				return []string{"pnpm", "install", "--lockfile-only", "--ignore-scripts"}
+			}},
+		},
+	},
+	{
+		name: "python",
+		manifest: func(file string) bool {
+			base := path.Base(file)
+			if base == "pyproject.toml" {
+				return true
+			}
+			if ok, _ := path.Match("requirements*.txt", base); ok {
+				return true
+			}
+			return path.Ext(base) == ".txt" && path.Base(path.Dir(file)) == "requirements"
+		},
+		normalize: func(version string) string {
+			if version != "" && version[0] >= '0' && version[0] <= '9' {
+				return "==" + version
+			}
+			return version
+		},
+		edit: editPythonManifest,
+		lockfiles: []lockfileTool{
+			{"poetry.lock", poetryLockCommand},
+			{"uv.lock", func(pkg string) []string { return []string{"uv", "lock"} }},
+		},
+	},
+	{
+		name: "cargo",
+		manifest: func(file string) bool {
+			return path.Base(file) == "Cargo.toml"
+		},
+		normalize: func(version string) string {
+			return version
+		},
+		edit: func(file string, content []byte, pkg string, version string) ([]byte, int, error) {
+			newContent, count := editTomlDependencies(content, pkg, version, isCargoDependencyTable, func(a, b string) bool {
+				return a == b
+			})
+			return newContent, count, nil
+		},
+		lockfiles: []lockfileTool{
+			{"Cargo.lock", func(pkg string) []string { return []string{"cargo", "update", "--package", pkg} }},
+		},
+	},
+}
+
+var (
+	goRequireRegex      = regexp.MustCompile(`^(\s*require\s+)(\S+)(\s+)(\S+)(.*)$`)
+	goRequireBlockRegex = regexp.MustCompile(`^(\s*)(\S+)(\s+)(v\S+)(.*)$`)
+)
+
+func editGoMod(file string, content []byte, pkg string, version string) ([]byte, int, error) {
+	lines := strings.Split(string(content), "\n")
+	count := 0
+	inRequire := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if inRequire {
+			if trimmed == ")" {
+				inRequire = false
+				continue
+			}
+
+			if matches := goRequireBlockRegex.FindStringSubmatch(line); matches != nil && matches[2] == pkg {
+				lines[i] = matches[1] + matches[2] + matches[3] + version + matches[5]
+				count++
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "require") && strings.HasSuffix(strings.TrimSpace(strings.TrimPrefix(trimmed, "require")), "(") {
+			inRequire = true
+			continue
+		}
+
+		if matches := goRequireRegex.FindStringSubmatch(line); matches != nil && matches[2] == pkg {
+			lines[i] = matches[1] + matches[2] + matches[3] + version + matches[5]
+			count++
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), count, nil
+}
+
+var packageJSONSections = map[string]bool{
+	"dependencies":         true,
+	"devDependencies":      true,
+	"peerDependencies":     true,
+	"optionalDependencies": true,
+}
+
+// skipJSONValue reads the rest of a value of which first is the first token
+func skipJSONValue(decoder *json.Decoder, first json.Token) error {
+	if delim, ok := first.(json.Delim); !ok || (delim != '{' && delim != '[') {
+		return nil
+	}
+
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+
+	return nil
+}
+
+// editPackageJSON only replaces the bytes of each version, so the formatting of
+// the rest of the file is kept as it is
+func editPackageJSON(file string, content []byte, pkg string, version string) ([]byte, int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil {
+		return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+	} else if token != json.Delim('{') {
+		return content, 0, nil
+	}
+
+	// The start and end offsets of every version of the package
+	spans := [][2]int{}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+		}
+
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+		}
+
+		if token != json.Delim('{') || !packageJSONSections[key.(string)] {
+			if err := skipJSONValue(decoder, token); err != nil {
+				return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+			}
+			continue
+		}
+
+		for decoder.More() {
+			name, err := decoder.Token()
+			if err != nil {
+				return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+			}
+			nameEnd := int(decoder.InputOffset())
+
+			value, err := decoder.Token()
+			if err != nil {
+				return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+			}
+			if err := skipJSONValue(decoder, value); err != nil {
+				return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+			}
+
+			if name == pkg {
+				// Only whitespace and the colon come between the name and its value
+				start := nameEnd + bytes.IndexFunc(content[nameEnd:], func(r rune) bool {
+					return r != ':' && r != ' ' && r != '\t' && r != '\r' && r != '\n'
+				})
+				spans = append(spans, [2]int{start, int(decoder.InputOffset())})
+			}
+		}
+
+		if _, err := decoder.Token(); err != nil {
+			return nil, 0, fmt.Errorf("Failed to parse JSON: %w", err)
+		}
+	}
+
+	if len(spans) == 0 {
+		return content, 0, nil
+	}
+
+	var quoted bytes.Buffer
+	if err := writeJSONString(&quoted, version); err != nil {
+		return nil, 0, err
+	}
+
+	newContent := []byte{}
+	last := 0
+	for _, span := range spans {
+		newContent = append(newContent, content[last:span[0]]...)
+		newContent = append(newContent, quoted.Bytes()...)
+		last = span[1]
+	}
+	newContent = append(newContent, content[last:]...)
+
+	return newContent, len(spans), nil
+}
+
+var pythonNameSeparatorRegex = regexp.MustCompile(`[-_.]+`)
+
+// normalizePythonName normalizes a Python package name, as described in PEP 503
+func normalizePythonName(name string) string {
+	return strings.ToLower(pythonNameSeparatorRegex.ReplaceAllString(name, "-"))
+}
+
+// A PEP 508 requirement: the name, extras, version specifier, and then markers or
+// a comment, which are kept as they are
+var pythonRequirementRegex = regexp.MustCompile(`^(\s*)([A-Za-z0-9][A-Za-z0-9._-]*)(\s*\[[^\]]*\])?(\s*)([^;#]*?)(\s*(?:[;#].*)?)$`)
+
+// editRequirement returns the requirement with its version specifier replaced, if
+// it is a requirement of pkg
+func editRequirement(requirement string, pkg string, version string) (string, bool) {
+	matches := pythonRequirementRegex.FindStringSubmatch(requirement)
+	if matches == nil || normalizePythonName(matches[2]) != normalizePythonName(pkg) {
+		return requirement, false
+	}
+
+	return matches[1] + matches[2] + matches[3] + version + matches[6], true
+}
+
+func editRequirementsTxt(content []byte, pkg string, version string) ([]byte, int) {
+	lines := strings.Split(string(content), "\n")
+	count := 0
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "-") {
+			continue
+		}
+
+		if newLine, ok := editRequirement(line, pkg, version); ok {
+			lines[i] = newLine
+			count++
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), count
+}
+
+var (
+	tomlTableRegex      = regexp.MustCompile(`^\s*\[([^\[\]]+)\]\s*(#.*)?$`)
+	tomlArrayStartRegex = regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|[A-Za-z0-9_-]+)\s*=\s*\[`)
+	tomlStringRegex     = regexp.MustCompile(`"([^"\\]*)"|'([^']*)'`)
+)
+
+// editPyproject updates the PEP 621 dependency arrays of a pyproject.toml. Poetry's
+// dependency tables are handled like those of Cargo
+func editPyproject(content []byte, pkg string, version string) ([]byte, int) {
+	lines := strings.Split(string(content), "\n")
+	count := 0
+	table := ""
+	inArray := false
+
+	for i, line := range lines {
+		if matches := tomlTableRegex.FindStringSubmatch(line); matches != nil && !inArray {
+			table = strings.TrimSpace(matches[1])
+			continue
+		}
+
+		start := 0
+		if !inArray {
+			matches := tomlArrayStartRegex.FindStringSubmatchIndex(line)
+			if matches == nil {
+				continue
+			}
+
+			key := strings.Trim(line[matches[2]:matches[3]], `"'`)
+			isDependencyArray := (table == "project" && key == "dependencies") ||
+				table == "project.optional-dependencies" ||
+				table == "dependency-groups" ||
+				(table == "build-system" && key == "requires")
+			if !isDependencyArray {
+				continue
+			}
+
+			inArray = true
+			start = matches[1]
+		}
+
+		rest := line[start:]
+		if end := strings.Index(rest, "]"); end != -1 && !strings.Contains(tomlStringRegex.ReplaceAllString(rest[:end], ""), "[") {
+			inArray = false
+		}
+
+		lines[i] = line[:start] + tomlStringRegex.ReplaceAllStringFunc(rest, func(s string) string {
+			quote := s[:1]
+			newRequirement, ok := editRequirement(s[1:len(s)-1], pkg, version)
+			if !ok {
+				return s
+			}
+
+			count++
+			return quote + newRequirement + quote
+		})
+	}
+
+	newContent, poetryCount := editTomlDependencies([]byte(strings.Join(lines, "\n")), pkg, version, isPoetryDependencyTable, func(a, b string) bool {
+		return normalizePythonName(a) == normalizePythonName(b)
+	})
+
+	return newContent, count + poetryCount
+}
+
+func editPythonManifest(file string, content []byte, pkg string, version string) ([]byte, int, error) {
+	if path.Base(file) == "pyproject.toml" {
+		newContent, count := editPyproject(content, pkg, version)
+		return newContent, count, nil
+	}
+
+	newContent, count := editRequirementsTxt(content, pkg, version)
+	return newContent, count, nil
+}
+
+func isCargoDependencyTable(table string) bool {
+	for _, name := range []string{"dependencies", "dev-dependencies", "build-dependencies"} {
+		if table == name || table == "workspace."+name {
+			return true
+		}
+
+		if strings.HasPrefix(table, "target.") && strings.HasSuffix(table, "."+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPoetryDependencyTable(table string) bool {
+	if table == "tool.poetry.dependencies" || table == "tool.poetry.dev-dependencies" {
+		return true
+	}
+
+	return strings.HasPrefix(table, "tool.poetry.group.") && strings.HasSuffix(table, ".dependencies")
+}
+
+var (
+	tomlKeyValueRegex = regexp.MustCompile(`^(\s*)("[^"]*"|'[^']*'|[A-Za-z0-9_.-]+)(\s*=\s*)(.*)$`)
+	tomlVersionRegex  = regexp.MustCompile(`(\bversion\s*=\s*)("[^"]*"|'[^']*')`)
+)
+
+// editTomlDependencies rewrites the version of pkg in the dependency tables of a
+// TOML file (both "pkg = version" and "pkg = { version = ... }", and also tables
+// like [dependencies.pkg]). Other formatting and comments are left alone
+func editTomlDependencies(content []byte, pkg string, version string, isTable func(table string) bool, equal func(a, b string) bool) ([]byte, int) {
+	lines := strings.Split(string(content), "\n")
+	count := 0
+	inDependencies := false
+	inDependency := false
+
+	for i, line := range lines {
+		if matches := tomlTableRegex.FindStringSubmatch(line); matches != nil {
+			table := strings.TrimSpace(matches[1])
+			inDependencies = isTable(table)
+			inDependency = false
+
+			if dot := strings.LastIndex(table, "."); dot != -1 && isTable(table[:dot]) && equal(strings.Trim(table[dot+1:], `"'`), pkg) {
+				inDependency = true
+				count++
+			}
+			continue
+		}
+
+		matches := tomlKeyValueRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		if inDependency {
+			if matches[2] == "version" {
+				lines[i] = matches[1] + matches[2] + matches[3] + fmt.Sprintf("%q", version)
+			}
+			continue
+		}
+
+		if !inDependencies {
+			continue
+		}
+
+		// Dotted keys, like "pkg.version" or "pkg.workspace"
+		key := strings.Trim(matches[2], `"'`)
+		if dot := strings.Index(key, "."); dot != -1 && equal(key[:dot], pkg) {
+			if key[dot+1:] == "version" {
+				lines[i] = matches[1] + matches[2] + matches[3] + fmt.Sprintf("%q", version)
+			}
+			count++
+			continue
+		}
+
+		if !equal(key, pkg) {
+			continue
+		}
+
+		value := matches[4]
+		switch {
+		case strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`):
+			// Keep any comment after the string
+			end := strings.IndexByte(value[1:], value[0])
+			if end == -1 {
+				continue
+			}
+			lines[i] = matches[1] + matches[2] + matches[3] + fmt.Sprintf("%q", version) + value[end+2:]
+		case strings.HasPrefix(value, "{"):
+			lines[i] = matches[1] + matches[2] + matches[3] + tomlVersionRegex.ReplaceAllString(value, "${1}"+strings.ReplaceAll(fmt.Sprintf("%q", version), "$", "$$"))
+		}
+		count++
+	}
+
+	return []byte(strings.Join(lines, "\n")), count
+}
+
+var poetryVersionRegex = regexp.MustCompile(`(\d+)\.\d+`)
+
+// poetryLockCommand returns the command that updates poetry.lock without updating
+// dependencies. That is the default since Poetry 2, which removed --no-update
+func poetryLockCommand(pkg string) []string {
+	output, err := exec.Command("poetry", "--version").Output()
+	if err != nil {
+		return []string{"poetry", "lock", "--no-update"}
+	}
+
+	if matches := poetryVersionRegex.FindSubmatch(output); matches != nil {
+		if major, err := strconv.Atoi(string(matches[1])); err == nil && major >= 2 {
+			return []string{"poetry", "lock"}
+		}
+	}
+
+	return []string{"poetry", "lock", "--no-update"}
+}
+
+// runLockfileTools regenerates the lockfiles next to a changed manifest. Tools that
+// are not installed are skipped
+func runLockfileTools(g *Guardian, repo *store.Repo, ecosystem dependencyEcosystem, manifest string, pkg string) error {
+	dir := filepath.Join(repo.Dir, filepath.Dir(manifest))
+
+	for _, tool := range ecosystem.lockfiles {
+		if exists, err := fileExists(filepath.Join(dir, tool.lockfile)); err != nil {
+			return err
+		} else if !exists {
+			continue
+		}
+
+		args := tool.command(pkg)
+		executable, err := exec.LookPath(args[0])
+		if err != nil {
+			g.logger.Info(fmt.Sprintf("Not updating %s in %s (%s is not installed)", filepath.Join(filepath.Dir(manifest), tool.lockfile), repo.Name, args[0]))
+			continue
+		}
+
+		cmd := exec.Command(executable, args[1:]...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("Failed to run '%s' for %s: %w: %s", strings.Join(args, " "), manifest, err, output)
+		}
+	}
+
+	return nil
+}
+
+func transformDependency(g *Guardian, repo *store.Repo, transformer store.Transformer) (TransformerReport, error) {
+	report := TransformerReport{
+		Repo:        repo.Name,
+		Transformer: transformer.Name,
+		Matches:     map[string]int{},
+	}
+
+	var c dependencyContent
+	if err := json.Unmarshal([]byte(transformer.Content), &c); err != nil {
+		return report, fmt.Errorf("Failed to parse dependency transformer content: %w", err)
+	}
+
+	if c.Package == "" || c.Version == "" {
+		return report, fmt.Errorf("Dependency transformer must have a package and a version")
+	}
+
+	ecosystems := []dependencyEcosystem{}
+	for _, ecosystem := range dependencyEcosystems {
+		if len(c.Ecosystems) == 0 {
+			ecosystems = append(ecosystems, ecosystem)
+			continue
+		}
+
+		for _, name := range c.Ecosystems {
+			if name == ecosystem.name {
+				ecosystems = append(ecosystems, ecosystem)
+			}
+		}
+	}
+	if len(ecosystems) == 0 {
+		return report, fmt.Errorf("Unknown ecosystems: %s", strings.Join(c.Ecosystems, ", "))
+	}
+
+	changed := map[string]dependencyEcosystem{}
+	if err := rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+		for _, ecosystem := range ecosystems {
+			if !ecosystem.manifest(file) {
+				continue
+			}
+
+			newContent, count, err := ecosystem.edit(file, content, c.Package, ecosystem.normalize(c.Version))
+			if err != nil {
+				return nil, err
+			}
+
+			if count > 0 {
+				report.Matches[file] = count
+			}
+			if !bytes.Equal(newContent, content) {
+				changed[file] = ecosystem
+			}
+
+			return newContent, nil
+		}
+
+		return content, nil
+	}); err != nil {
+		return report, err
+	}
+
+	if len(report.Matches) == 0 {
+		report.Missing = true
+		g.logger.Info(fmt.Sprintf("%s does not depend on %s", repo.Name, c.Package))
+		return report, nil
+	}
+
+	if !c.SkipLockfile {
+		manifests := make([]string, 0, len(changed))
+		for manifest := range changed {
+			manifests = append(manifests, manifest)
+		}
+		sort.Strings(manifests)
+
+		for _, manifest := range manifests {
+			if err := runLockfileTools(g, repo, changed[manifest], manifest, c.Package); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
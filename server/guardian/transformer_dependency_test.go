@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDependencyEditors(t *testing.T) {
+	tests := []struct {
+		name      string
+		ecosystem string
+		file      string
+		content   string
+		pkg       string
+		version   string
+		want      string
+		count     int
+	}{
+		{
+			name:      "go.mod require",
+			ecosystem: "go",
+			file:      "go.mod",
+			content:   "module example.com/a\n\ngo 1.18\n\nrequire github.com/a/b v1.0.0 // indirect\n",
+			pkg:       "github.com/a/b",
+			version:   "v1.2.0",
+			want:      "module example.com/a\n\ngo 1.18\n\nrequire github.com/a/b v1.2.0 // indirect\n",
+			count:     1,
+		},
+		{
+			name:      "go.mod require block",
+			ecosystem: "go",
+			file:      "go.mod",
+			content:   "module example.com/a\n\nrequire (\n\tgithub.com/a/b v1.0.0\n\tgithub.com/a/bc v1.0.0\n)\n",
+			pkg:       "github.com/a/b",
+			version:   "v1.2.0",
+			want:      "module example.com/a\n\nrequire (\n\tgithub.com/a/b v1.2.0\n\tgithub.com/a/bc v1.0.0\n)\n",
+			count:     1,
+		},
+		{
+			name:      "package.json",
+			ecosystem: "npm",
+			file:      "package.json",
+			content:   "{\n  \"keywords\": [\"lodash\"],\n  \"dependencies\": {\"lodash\": \"^4.0.0\"},\n  \"devDependencies\": {\n    \"lodash\":\"4.0.0\"\n  }\n}\n",
+			pkg:       "lodash",
+			version:   "^4.17.21",
+			want:      "{\n  \"keywords\": [\"lodash\"],\n  \"dependencies\": {\"lodash\": \"^4.17.21\"},\n  \"devDependencies\": {\n    \"lodash\":\"^4.17.21\"\n  }\n}\n",
+			count:     2,
+		},
+		{
+			name:      "package.json without the package",
+			ecosystem: "npm",
+			file:      "package.json",
+			content:   "{\"name\": \"lodash\", \"dependencies\": {\"react\": \"^18.0.0\"}}",
+			pkg:       "lodash",
+			version:   "^4.17.21",
+			want:      "{\"name\": \"lodash\", \"dependencies\": {\"react\": \"^18.0.0\"}}",
+			count:     0,
+		},
+		{
+			name:      "requirements.txt",
+			ecosystem: "python",
+			file:      "requirements.txt",
+			content:   "# Pinned\nRequests[socks]==2.0.0 ; python_version >= \"3.8\"\nrequests-oauthlib==1.0.0\n-r other.txt\n",
+			pkg:       "requests",
+			version:   "==2.31.0",
+			want:      "# Pinned\nRequests[socks]==2.31.0 ; python_version >= \"3.8\"\nrequests-oauthlib==1.0.0\n-r other.txt\n",
+			count:     1,
+		},
+		{
+			name:      "pyproject PEP 621",
+			ecosystem: "python",
+			file:      "pyproject.toml",
+			content:   "[project]\nname = \"example\"\ndependencies = [\n    \"requests>=2.0\",\n    \"rich\",\n]\n\n[project.optional-dependencies]\nsocks = [\"requests[socks]>=2.0\"]\n",
+			pkg:       "requests",
+			version:   ">=2.31,<3",
+			want:      "[project]\nname = \"example\"\ndependencies = [\n    \"requests>=2.31,<3\",\n    \"rich\",\n]\n\n[project.optional-dependencies]\nsocks = [\"requests[socks]>=2.31,<3\"]\n",
+			count:     2,
+		},
+		{
+			name:      "pyproject Poetry",
+			ecosystem: "python",
+			file:      "pyproject.toml",
+			content:   "[tool.poetry.dependencies]\npython = \"^3.8\"\nRequests = \"^2.0\" # HTTP\n\n[tool.poetry.group.dev.dependencies]\nrequests = { version = \"^2.0\", extras = [\"socks\"] }\n",
+			pkg:       "requests",
+			version:   "^2.31",
+			want:      "[tool.poetry.dependencies]\npython = \"^3.8\"\nRequests = \"^2.31\" # HTTP\n\n[tool.poetry.group.dev.dependencies]\nrequests = { version = \"^2.31\", extras = [\"socks\"] }\n",
+			count:     2,
+		},
+		{
+			name:      "Cargo.toml",
+			ecosystem: "cargo",
+			file:      "Cargo.toml",
+			content:   "[package]\nname = \"serde\"\nversion = \"0.1.0\"\n\n[dependencies]\nserde = \"1.0\"\nserde_json = \"1.0\"\n\n[dev-dependencies]\nserde = { version = \"1.0\", features = [\"derive\"] }\n\n[target.'cfg(unix)'.dependencies.serde]\nversion = \"1.0\"\n",
+			pkg:       "serde",
+			version:   "1.0.190",
+			want:      "[package]\nname = \"serde\"\nversion = \"0.1.0\"\n\n[dependencies]\nserde = \"1.0.190\"\nserde_json = \"1.0\"\n\n[dev-dependencies]\nserde = { version = \"1.0.190\", features = [\"derive\"] }\n\n[target.'cfg(unix)'.dependencies.serde]\nversion = \"1.0.190\"\n",
+			count:     3,
+		},
+		{
+			name:      "Cargo.toml workspace dependency",
+			ecosystem: "cargo",
+			file:      "Cargo.toml",
+			content:   "[dependencies]\nserde.workspace = true\n",
+			pkg:       "serde",
+			version:   "1.0.190",
+			want:      "[dependencies]\nserde.workspace = true\n",
+			count:     1,
+		},
+	}
+	for _, test := range tests {
+		var edit func(file string, content []byte, pkg string, version string) ([]byte, int, error)
+		for _, ecosystem := range dependencyEcosystems {
+			if ecosystem.name == test.ecosystem {
+				if !ecosystem.manifest(test.file) {
+					t.Errorf("%s: %s is not a manifest", test.name, test.file)
+				}
+				edit = ecosystem.edit
+			}
+		}
+
+		got, count, err := edit(test.file, []byte(test.content), test.pkg, test.version)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want || count != test.count {
+			t.Errorf("%s: %d edits:\n%s\nwant %d edits:\n%s", test.name, count, got, test.count, test.want)
+		}
+	}
+}
+
+func TestPoetryLockCommand(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"", []string{"poetry", "lock", "--no-update"}},
+		{"Poetry (version 1.8.3)", []string{"poetry", "lock", "--no-update"}},
+		{"Poetry (version 2.0.1)", []string{"poetry", "lock"}},
+	}
+	for _, test := range tests {
+		// A fake poetry, or none at all
+		dir := t.TempDir()
+		if test.version != "" {
+			script := "#!/bin/sh\necho '" + test.version + "'\n"
+			if err := ioutil.WriteFile(filepath.Join(dir, "poetry"), []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		t.Setenv("PATH", dir)
+
+		if got := poetryLockCommand("requests"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: %v, want %v", test.version, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// Overwrite policies of the "file-write" and "file-move" transformers, for when
+// the destination already exists. With "if-unchanged", the destination is only
+// replaced if the hex-encoded SHA-256 of its content is equal to the given hash
+// (ex. that of a config file that was never customized)
+const (
+	overwriteAlways      = "always"
+	overwriteIfMissing   = "if-missing"
+	overwriteIfUnchanged = "if-unchanged"
+)
+
+// The content of a "file-write" transformer is a JSON object of this shape. Overwrite
+// defaults to "always"
+type fileWriteContent struct {
+	Path       string `json:"path"`
+	Content    string `json:"content"`
+	Executable bool   `json:"executable"`
+	Overwrite  string `json:"overwrite"`
+	Hash       string `json:"hash"`
+}
+
+// The content of a "file-delete" transformer is a JSON object of this shape. Every
+// tracked file that matches is deleted
+type fileDeleteContent struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// The content of a "file-move" transformer is a JSON object of this shape. From
+// may be a file or a directory. Overwrite defaults to "if-missing"
+type fileMoveContent struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Overwrite string `json:"overwrite"`
+	Hash      string `json:"hash"`
+}
+
+func validateOverwrite(policy string, hash string) error {
+	switch policy {
+	case overwriteAlways, overwriteIfMissing:
+	case overwriteIfUnchanged:
+		if hash == "" {
+			return fmt.Errorf("Overwrite policy '%s' requires a hash", policy)
+		}
+	default:
+		return fmt.Errorf("Unknown overwrite policy: %s (must be one of %s, %s, %s)", policy, overwriteAlways, overwriteIfMissing, overwriteIfUnchanged)
+	}
+
+	return nil
+}
+
+// mayOverwrite reports whether the file at path may be replaced according to an
+// overwrite policy. Files that do not exist may always be written
+func mayOverwrite(path string, policy string, hash string) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if info.IsDir() {
+		return false, fmt.Errorf("Destination is a directory: %s", path)
+	}
+
+	switch policy {
+	case overwriteAlways:
+		return true, nil
+	case overwriteIfMissing:
+		return false, nil
+	case overwriteIfUnchanged:
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+
+		sum := sha256.Sum256(content)
+		return strings.EqualFold(hex.EncodeToString(sum[:]), strings.TrimPrefix(hash, "sha256:")), nil
+	}
+
+	return false, fmt.Errorf("Unknown overwrite policy: %s", policy)
+}
+
+func transformFileWrite(g *Guardian, repo *store.Repo, transformer store.Transformer) error {
+	var c fileWriteContent
+	if err := json.Unmarshal([]byte(transformer.Content), &c); err != nil {
+		return fmt.Errorf("Failed to parse file-write transformer content: %w", err)
+	}
+
+	if c.Overwrite == "" {
+		c.Overwrite = overwriteAlways
+	}
+	if err := validateOverwrite(c.Overwrite, c.Hash); err != nil {
+		return err
+	}
+
+	path, err := repoPath(repo, c.Path)
+	if err != nil {
+		return err
+	}
+
+	ok, err := mayOverwrite(path, c.Overwrite, c.Hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		g.logger.Info(fmt.Sprintf("Skipping %s in %s (overwrite policy is '%s')", c.Path, repo.Name, c.Overwrite))
+		return nil
+	}
+
+	mode := os.FileMode(0o644)
+	if c.Executable {
+		mode = 0o755
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, []byte(c.Content), mode); err != nil {
+		return err
+	}
+
+	// WriteFile does not change the mode of existing files
+	return os.Chmod(path, mode)
+}
+
+func transformFileDelete(repo *store.Repo, transformer store.Transformer) error {
+	var c fileDeleteContent
+	if err := json.Unmarshal([]byte(transformer.Content), &c); err != nil {
+		return fmt.Errorf("Failed to parse file-delete transformer content: %w", err)
+	}
+
+	if len(c.Include) == 0 {
+		return fmt.Errorf("File delete transformer must have at least one include pattern")
+	}
+
+	files, err := transformerFiles(repo, transformer, c.Include, c.Exclude)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(repo.Dir, file)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkMoveScope fails unless every file that a move removes and adds is within the
+// scope of the transformer. Changes outside of it are discarded afterwards, which
+// would lose the file, or leave it in both places
+func checkMoveScope(transformer store.Transformer, from string, fromName string, toName string) error {
+	if len(transformer.Include) == 0 && len(transformer.Exclude) == 0 {
+		return nil
+	}
+
+	fromName = filepath.ToSlash(filepath.Clean(fromName))
+	toName = filepath.ToSlash(filepath.Clean(toName))
+
+	paths := []string{}
+	err := filepath.WalkDir(from, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			paths = append(paths, fromName, toName)
+		} else {
+			paths = append(paths, fromName+"/"+filepath.ToSlash(rel), toName+"/"+filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	inScope, err := matchFiles(paths, transformer.Include, transformer.Exclude)
+	if err != nil {
+		return err
+	}
+	if len(inScope) != len(paths) {
+		return fmt.Errorf("Cannot move %s to %s, as both must be within the scope of the transformer", fromName, toName)
+	}
+
+	return nil
+}
+
+// transformFileMove renames a file or directory. The move is not staged here; once
+// both the removal and the addition are staged, git detects it as a rename
+func transformFileMove(g *Guardian, repo *store.Repo, transformer store.Transformer) error {
+	var c fileMoveContent
+	if err := json.Unmarshal([]byte(transformer.Content), &c); err != nil {
+		return fmt.Errorf("Failed to parse file-move transformer content: %w", err)
+	}
+
+	if c.Overwrite == "" {
+		c.Overwrite = overwriteIfMissing
+	}
+	if err := validateOverwrite(c.Overwrite, c.Hash); err != nil {
+		return err
+	}
+
+	from, err := repoPath(repo, c.From)
+	if err != nil {
+		return err
+	}
+
+	to, err := repoPath(repo, c.To)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(from); errors.Is(err, fs.ErrNotExist) {
+		g.logger.Info(fmt.Sprintf("Skipping move of %s in %s (it does not exist)", c.From, repo.Name))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := checkMoveScope(transformer, from, c.From, c.To); err != nil {
+		return err
+	}
+
+	ok, err := mayOverwrite(to, c.Overwrite, c.Hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		g.logger.Info(fmt.Sprintf("Skipping move of %s to %s in %s (overwrite policy is '%s')", c.From, c.To, repo.Name, c.Overwrite))
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+
+	return os.Rename(from, to)
+}
@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// The content of a "go-rewrite" transformer is a JSON object of this shape.
+// Rules are gofmt -r style rules (ex. "a[b:len(a)] -> a[b:]"). Imports rewrite
+// import paths equal to or nested under a key to the corresponding value. Renames
+// rename package-level identifiers, along with every reference to them that is not
+// shadowed by a local declaration
+type goRewriteContent struct {
+	Rules   []string          `json:"rules"`
+	Imports map[string]string `json:"imports"`
+	Renames []goRename        `json:"renames"`
+	Include []string          `json:"include"`
+	Exclude []string          `json:"exclude"`
+}
+
+// If Dir is empty, the identifier is renamed in every package that declares it.
+// Otherwise, only the package in that directory (relative to the repository) is
+// considered
+type goRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Dir  string `json:"dir"`
+}
+
+type goRewriteRule struct {
+	pattern ast.Expr
+	replace ast.Expr
+}
+
+var goModuleRegex = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+func parseGoRewriteContent(content string) (goRewriteContent, []goRewriteRule, error) {
+	var c goRewriteContent
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		return c, nil, fmt.Errorf("Failed to parse go-rewrite transformer content: %w", err)
+	}
+
+	if len(c.Include) == 0 {
+		c.Include = []string{"**/*.go"}
+	}
+
+	rules := []goRewriteRule{}
+	for _, rule := range c.Rules {
+		parts := strings.Split(rule, "->")
+		if len(parts) != 2 {
+			return c, nil, fmt.Errorf("Rewrite rule must be of the form 'pattern -> replacement': %s", rule)
+		}
+
+		pattern, err := parser.ParseExpr(parts[0])
+		if err != nil {
+			return c, nil, fmt.Errorf("Failed to parse pattern of rewrite rule '%s': %w", rule, err)
+		}
+
+		replace, err := parser.ParseExpr(parts[1])
+		if err != nil {
+			return c, nil, fmt.Errorf("Failed to parse replacement of rewrite rule '%s': %w", rule, err)
+		}
+
+		rules = append(rules, goRewriteRule{pattern: pattern, replace: replace})
+	}
+
+	for _, rename := range c.Renames {
+		if !token.IsIdentifier(rename.From) || !token.IsIdentifier(rename.To) {
+			return c, nil, fmt.Errorf("Renames must be between valid identifiers: %s -> %s", rename.From, rename.To)
+		}
+	}
+
+	return c, rules, nil
+}
+
+// goPackageKey identifies a package by its directory and name, since a directory
+// may contain both a package and its external test package
+type goPackageKey struct {
+	dir  string
+	name string
+}
+
+// goImportPath returns the import path of the package in dir (relative to the
+// repository), given the module path from the go.mod at the repository root
+func goImportPath(modulePath string, dir string) string {
+	if dir == "." {
+		return modulePath
+	}
+
+	return path.Join(modulePath, filepath.ToSlash(dir))
+}
+
+// rewriteGoImports rewrites import paths, returning whether anything changed
+func rewriteGoImports(file *ast.File, imports map[string]string) bool {
+	changed := false
+
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		for oldPath, newPath := range imports {
+			if importPath == oldPath || strings.HasPrefix(importPath, oldPath+"/") {
+				spec.Path.Value = strconv.Quote(newPath + strings.TrimPrefix(importPath, oldPath))
+				changed = true
+				break
+			}
+		}
+	}
+
+	return changed
+}
+
+// renameGoDeclaration renames a package-level identifier in a file that is part of
+// the declaring package. Identifiers declared in the file itself are resolved by the
+// parser; identifiers declared in other files of the package are left unresolved.
+// Identifiers resolved to anything else (ex. a local variable) are shadowed
+func renameGoDeclaration(file *ast.File, rename goRename) bool {
+	changed := false
+
+	declared := file.Scope.Lookup(rename.From)
+	unresolved := map[*ast.Ident]bool{}
+	for _, ident := range file.Unresolved {
+		unresolved[ident] = true
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Ident)
+		if !ok || ident.Name != rename.From {
+			return true
+		}
+
+		if (declared != nil && ident.Obj == declared) || (ident.Obj == nil && unresolved[ident]) {
+			ident.Name = rename.To
+			changed = true
+		}
+
+		return true
+	})
+
+	return changed
+}
+
+// renameGoQualified renames qualified references (pkg.Ident) to an identifier of the
+// package with the given import path
+func renameGoQualified(file *ast.File, importPath string, rename goRename) bool {
+	changed := false
+
+	names := map[string]bool{}
+	for _, spec := range file.Imports {
+		specPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || specPath != importPath {
+			continue
+		}
+
+		if spec.Name != nil {
+			names[spec.Name.Name] = true
+		} else {
+			names[path.Base(importPath)] = true
+		}
+	}
+
+	if len(names) == 0 {
+		return false
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		selector, ok := node.(*ast.SelectorExpr)
+		if !ok || selector.Sel.Name != rename.From {
+			return true
+		}
+
+		// An identifier that resolves to an object is a local declaration shadowing
+		// the import
+		if x, ok := selector.X.(*ast.Ident); ok && x.Obj == nil && names[x.Name] {
+			selector.Sel.Name = rename.To
+			changed = true
+		}
+
+		return true
+	})
+
+	return changed
+}
+
+func transformGoRewrite(repo *store.Repo, transformer store.Transformer) error {
+	c, rules, err := parseGoRewriteContent(transformer.Content)
+	if err != nil {
+		return err
+	}
+
+	modulePath := ""
+	if content, err := ioutil.ReadFile(filepath.Join(repo.Dir, "go.mod")); err == nil {
+		if match := goModuleRegex.FindSubmatch(content); match != nil {
+			modulePath = string(match[1])
+		}
+	}
+
+	// Renames need to know, in advance, which packages declare each identifier
+	declaringPackages := make([]map[goPackageKey]bool, len(c.Renames))
+	for i := range declaringPackages {
+		declaringPackages[i] = map[goPackageKey]bool{}
+	}
+	if len(c.Renames) > 0 {
+		if err := rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+			f, err := parser.ParseFile(token.NewFileSet(), file, content, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			dir := filepath.Dir(file)
+			for i, rename := range c.Renames {
+				if rename.Dir != "" && filepath.Clean(rename.Dir) != dir {
+					continue
+				}
+
+				if f.Scope.Lookup(rename.From) != nil {
+					declaringPackages[i][goPackageKey{dir: dir, name: f.Name.Name}] = true
+				}
+			}
+
+			return content, nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file, content, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		// Renames are done first, as they depend on the identifier resolution done by
+		// the parser (which applying rules discards) and on the original import paths
+		changed := false
+		for i, rename := range c.Renames {
+			key := goPackageKey{dir: filepath.Dir(file), name: f.Name.Name}
+			if declaringPackages[i][key] {
+				changed = renameGoDeclaration(f, rename) || changed
+			}
+
+			if modulePath != "" && token.IsExported(rename.From) {
+				for pkg := range declaringPackages[i] {
+					changed = renameGoQualified(f, goImportPath(modulePath, pkg.dir), rename) || changed
+				}
+			}
+		}
+
+		if len(c.Imports) > 0 {
+			changed = rewriteGoImports(f, c.Imports) || changed
+		}
+
+		for _, rule := range rules {
+			var matched bool
+			f, matched = rewriteFile(fset, rule.pattern, rule.replace, f)
+			changed = matched || changed
+		}
+
+		if !changed {
+			return content, nil
+		}
+
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, f); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	})
+}
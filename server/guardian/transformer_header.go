@@ -0,0 +1,221 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// The content of a "header" transformer is a JSON object of this shape. Header is
+// the text of the comment, without comment syntax. If a file already starts with
+// a comment that matches the detect regex (by default, one that mentions a
+// copyright or license), it is replaced; otherwise, the header is inserted. A
+// comment made of line comments ends at a blank line, so comments after it (like
+// package documentation) are kept
+type headerContent struct {
+	Header  string   `json:"header"`
+	Detect  string   `json:"detect"`
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+const defaultHeaderDetect = `(?i)copyright|license|spdx-license-identifier`
+
+// A commentStyle is either a line comment (only prefix is set), or a block comment
+type commentStyle struct {
+	start  string
+	prefix string
+	end    string
+}
+
+var (
+	slashComment = commentStyle{prefix: "//"}
+	hashComment  = commentStyle{prefix: "#"}
+	dashComment  = commentStyle{prefix: "--"}
+	semiComment  = commentStyle{prefix: ";;"}
+	starComment  = commentStyle{start: "/*", prefix: " *", end: " */"}
+	htmlComment  = commentStyle{start: "<!--", prefix: "", end: "-->"}
+)
+
+var commentStyles = map[string]commentStyle{
+	".go": slashComment, ".c": slashComment, ".h": slashComment, ".cc": slashComment,
+	".cpp": slashComment, ".hpp": slashComment, ".cs": slashComment, ".java": slashComment,
+	".kt": slashComment, ".kts": slashComment, ".scala": slashComment, ".swift": slashComment,
+	".rs": slashComment, ".dart": slashComment, ".zig": slashComment, ".proto": slashComment,
+	".groovy": slashComment, ".js": slashComment, ".jsx": slashComment, ".mjs": slashComment,
+	".cjs": slashComment, ".ts": slashComment, ".tsx": slashComment, ".php": slashComment,
+
+	".py": hashComment, ".sh": hashComment, ".bash": hashComment, ".zsh": hashComment,
+	".fish": hashComment, ".rb": hashComment, ".pl": hashComment, ".r": hashComment,
+	".yaml": hashComment, ".yml": hashComment, ".toml": hashComment, ".nix": hashComment,
+	".tf": hashComment, ".ps1": hashComment, ".cmake": hashComment, ".mk": hashComment,
+
+	".sql": dashComment, ".lua": dashComment, ".hs": dashComment, ".elm": dashComment,
+
+	".el": semiComment, ".lisp": semiComment, ".clj": semiComment, ".scm": semiComment,
+
+	".css": starComment, ".scss": starComment, ".less": starComment,
+
+	".html": htmlComment, ".xml": htmlComment, ".svg": htmlComment, ".vue": htmlComment,
+}
+
+var commentStylesByName = map[string]commentStyle{
+	"Makefile":      hashComment,
+	"Dockerfile":    hashComment,
+	"CMakeLists":    hashComment,
+	"Containerfile": hashComment,
+}
+
+var (
+	generatedRegex = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+	preambleRegex  = regexp.MustCompile(`^(#!|<\?xml|<!DOCTYPE|<\?php|# -\*-|# vim:|#\s*(?:-\*-\s*)?coding[:=])`)
+)
+
+func commentStyleFor(file string) (commentStyle, bool) {
+	base := path.Base(file)
+	if style, ok := commentStylesByName[strings.TrimSuffix(base, path.Ext(base))]; ok {
+		return style, true
+	}
+
+	style, ok := commentStyles[strings.ToLower(path.Ext(base))]
+	return style, ok
+}
+
+// formatHeader returns the lines of text as a comment
+func formatHeader(text string, style commentStyle) []string {
+	lines := []string{}
+	if style.start != "" {
+		lines = append(lines, style.start)
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" || style.prefix == "" {
+			lines = append(lines, strings.TrimRight(style.prefix+line, " "))
+		} else {
+			lines = append(lines, style.prefix+" "+line)
+		}
+	}
+
+	if style.end != "" {
+		lines = append(lines, style.end)
+	}
+
+	return lines
+}
+
+// leadingHeader returns the number of lines of the existing header at the start of
+// lines, or 0 if there is none. The header is the comment at the start of lines,
+// if any of it matches detect. Line comments end at a blank line, a line that is
+// not a comment, or a directive
+func leadingHeader(lines []string, style commentStyle, detect *regexp.Regexp) int {
+	if len(lines) == 0 {
+		return 0
+	}
+
+	if style.start != "" {
+		if !strings.HasPrefix(strings.TrimSpace(lines[0]), strings.TrimSpace(style.start)) {
+			return 0
+		}
+
+		for i, line := range lines {
+			if strings.Contains(line, strings.TrimSpace(style.end)) && (i > 0 || strings.Index(line, strings.TrimSpace(style.end)) >= len(strings.TrimSpace(style.start))) {
+				if detect.MatchString(strings.Join(lines[:i+1], "\n")) {
+					return i + 1
+				}
+
+				return 0
+			}
+		}
+
+		return 0
+	}
+
+	count := 0
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		// Exclude directives like '//go:build' and '#!'
+		if !strings.HasPrefix(trimmed, style.prefix) || strings.HasPrefix(trimmed, "//go:") || strings.HasPrefix(trimmed, "#!") {
+			break
+		}
+		count++
+	}
+
+	if count == 0 || !detect.MatchString(strings.Join(lines[:count], "\n")) {
+		return 0
+	}
+
+	return count
+}
+
+// insertHeader returns content with header at its start, after lines that must
+// come first (like shebangs and XML declarations), replacing an existing header
+func insertHeader(content string, header []string, style commentStyle, detect *regexp.Regexp) string {
+	lines := strings.Split(content, "\n")
+
+	preamble := 0
+	for preamble < len(lines) && preamble < 2 && preambleRegex.MatchString(lines[preamble]) {
+		preamble++
+	}
+
+	rest := lines[preamble:]
+	for len(rest) > 0 && strings.TrimSpace(rest[0]) == "" {
+		rest = rest[1:]
+	}
+
+	n := leadingHeader(rest, style, detect)
+	if len(rest) >= len(header) && strings.Join(rest[:len(header)], "\n") == strings.Join(header, "\n") && n < len(header) {
+		n = len(header)
+	}
+	if n > 0 {
+		rest = rest[n:]
+		for len(rest) > 0 && strings.TrimSpace(rest[0]) == "" {
+			rest = rest[1:]
+		}
+	}
+
+	result := append([]string{}, lines[:preamble]...)
+	if preamble > 0 {
+		result = append(result, "")
+	}
+	result = append(result, header...)
+	result = append(result, "")
+	result = append(result, rest...)
+
+	return strings.Join(result, "\n")
+}
+
+func transformHeader(repo *store.Repo, transformer store.Transformer) error {
+	var c headerContent
+	if err := json.Unmarshal([]byte(transformer.Content), &c); err != nil {
+		return fmt.Errorf("Failed to parse header transformer content: %w", err)
+	}
+
+	if strings.TrimSpace(c.Header) == "" {
+		return fmt.Errorf("Header transformer must have a header")
+	}
+
+	if len(c.Include) == 0 {
+		return fmt.Errorf("Header transformer must include at least one glob")
+	}
+
+	if c.Detect == "" {
+		c.Detect = defaultHeaderDetect
+	}
+	detect, err := regexp.Compile(c.Detect)
+	if err != nil {
+		return fmt.Errorf("Failed to compile detect regex of header transformer: %w", err)
+	}
+
+	return rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+		style, ok := commentStyleFor(file)
+		if !ok || generatedRegex.Match(content) {
+			return content, nil
+		}
+
+		return []byte(insertHeader(string(content), formatHeader(c.Header, style), style, detect)), nil
+	})
+}
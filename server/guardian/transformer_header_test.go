@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"regexp"
+	"testing"
+)
+
+const apacheHeader = `// Copyright 2019 Example Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+`
+
+func TestInsertHeader(t *testing.T) {
+	detect := regexp.MustCompile(defaultHeaderDetect)
+	header := "// Copyright New\n//\n// SPDX-License-Identifier: MIT\n"
+
+	tests := []struct {
+		name    string
+		style   commentStyle
+		header  string
+		content string
+		want    string
+	}{
+		{
+			name:    "insert",
+			style:   slashComment,
+			header:  "Copyright New\n\nSPDX-License-Identifier: MIT",
+			content: "package foo\n",
+			want:    header + "\npackage foo\n",
+		},
+		{
+			name:    "replace a multi-line license",
+			style:   slashComment,
+			header:  "Copyright New\n\nSPDX-License-Identifier: MIT",
+			content: apacheHeader + "\npackage foo\n",
+			want:    header + "\npackage foo\n",
+		},
+		{
+			name:    "keep package documentation",
+			style:   slashComment,
+			header:  "Copyright New\n\nSPDX-License-Identifier: MIT",
+			content: apacheHeader + "\n// Package foo does things\npackage foo\n",
+			want:    header + "\n// Package foo does things\npackage foo\n",
+		},
+		{
+			name:    "keep unrelated comments",
+			style:   slashComment,
+			header:  "Copyright New\n\nSPDX-License-Identifier: MIT",
+			content: "// Package foo does things\npackage foo\n",
+			want:    header + "\n// Package foo does things\npackage foo\n",
+		},
+		{
+			name:    "keep directives",
+			style:   slashComment,
+			header:  "Copyright New\n\nSPDX-License-Identifier: MIT",
+			content: "// Copyright Old\n//go:build linux\n\npackage foo\n",
+			want:    header + "\n//go:build linux\n\npackage foo\n",
+		},
+		{
+			name:    "after a shebang",
+			style:   hashComment,
+			header:  "Copyright New",
+			content: "#!/bin/sh\n# Copyright Old\n# License: MIT\n\necho\n",
+			want:    "#!/bin/sh\n\n# Copyright New\n\necho\n",
+		},
+		{
+			name:    "replace a block comment",
+			style:   starComment,
+			header:  "Copyright New",
+			content: "/*\n * Copyright Old\n * All rights reserved.\n */\nbody {}\n",
+			want:    "/*\n * Copyright New\n */\n\nbody {}\n",
+		},
+		{
+			name:    "keep an unrelated block comment",
+			style:   starComment,
+			header:  "Copyright New",
+			content: "/* Layout */\nbody {}\n",
+			want:    "/*\n * Copyright New\n */\n\n/* Layout */\nbody {}\n",
+		},
+	}
+	for _, test := range tests {
+		header := formatHeader(test.header, test.style)
+
+		got := insertHeader(test.content, header, test.style, detect)
+		if got != test.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", test.name, got, test.want)
+			continue
+		}
+
+		if again := insertHeader(got, header, test.style, detect); again != got {
+			t.Errorf("%s: not idempotent:\n%s", test.name, again)
+		}
+	}
+}
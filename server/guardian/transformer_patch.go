@@ -0,0 +1,368 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// HunkReport counts how the hunks of a patch applied to a single file. Hunks are
+// clean if they applied exactly where the patch says, fuzzed if they applied at an
+// offset, with less context, or through a three-way merge, and rejected otherwise
+type HunkReport struct {
+	Clean    int `json:"clean"`
+	Fuzzed   int `json:"fuzzed"`
+	Rejected int `json:"rejected"`
+}
+
+// patchFile is the part of a unified diff that changes a single file
+type patchFile struct {
+	oldPath string
+	newPath string
+	hunks   int
+	content []byte
+}
+
+var (
+	hunkHeaderRegex   = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+	hunkOffsetRegex   = regexp.MustCompile(`^Hunk #(\d+) succeeded at \d+`)
+	hunkAppliedRegex  = regexp.MustCompile(`^Hunk #(\d+) applied cleanly`)
+	hunkRejectedRegex = regexp.MustCompile(`^Rejected hunk #(\d+)`)
+	patchCleanRegex   = regexp.MustCompile(`(?m)^Applied patch .* cleanly\.$`)
+)
+
+// paths returns the paths the changes apply to; there are two for renames
+func (file patchFile) paths() []string {
+	paths := []string{}
+	for _, path := range []string{file.oldPath, file.newPath} {
+		if path != "" && (len(paths) == 0 || paths[0] != path) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// patchPath strips the "a/" or "b/" prefix from a path in a diff header
+func patchPath(header string) string {
+	header = strings.TrimSpace(header)
+	if i := strings.IndexByte(header, '\t'); i != -1 {
+		header = header[:i]
+	}
+
+	if header == "/dev/null" {
+		return ""
+	}
+
+	if i := strings.IndexByte(header, '/'); i != -1 {
+		return header[i+1:]
+	}
+
+	return header
+}
+
+// splitPatch splits a unified diff (with or without 'diff --git' headers) into the
+// changes of each file
+func splitPatch(patch string) ([]patchFile, error) {
+	lines := strings.SplitAfter(patch, "\n")
+	files := []patchFile{}
+	var current *patchFile
+	var buf bytes.Buffer
+	oldRemaining, newRemaining := 0, 0
+
+	flush := func() {
+		if current != nil {
+			current.content = append([]byte(nil), buf.Bytes()...)
+			files = append(files, *current)
+		}
+		buf.Reset()
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+
+		// Lines within a hunk
+		if oldRemaining > 0 || newRemaining > 0 {
+			switch line[0] {
+			case ' ':
+				oldRemaining--
+				newRemaining--
+			case '-':
+				oldRemaining--
+			case '+':
+				newRemaining--
+			case '\\':
+			case '\n':
+				// Some editors strip the space from empty context lines
+				oldRemaining--
+				newRemaining--
+			default:
+				return nil, fmt.Errorf("Malformed hunk in patch: %q", strings.TrimRight(line, "\n"))
+			}
+
+			buf.WriteString(line)
+			continue
+		}
+
+		if strings.HasPrefix(line, `\`) && current != nil {
+			buf.WriteString(line)
+			continue
+		}
+
+		if strings.HasPrefix(line, "diff --git ") {
+			flush()
+			current = &patchFile{}
+			if fields := strings.Fields(strings.TrimPrefix(line, "diff --git ")); len(fields) == 2 {
+				current.oldPath = patchPath(fields[0])
+				current.newPath = patchPath(fields[1])
+			}
+		} else if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			// Without 'diff --git' headers, this starts the next file
+			if current == nil || current.hunks > 0 {
+				flush()
+				current = &patchFile{}
+			}
+
+			current.oldPath = patchPath(strings.TrimPrefix(line, "--- "))
+			current.newPath = patchPath(strings.TrimPrefix(lines[i+1], "+++ "))
+			buf.WriteString(line)
+			buf.WriteString(lines[i+1])
+			i++
+			continue
+		} else if matches := hunkHeaderRegex.FindStringSubmatch(line); matches != nil {
+			if current == nil {
+				return nil, fmt.Errorf("Patch has a hunk without a file header")
+			}
+
+			oldRemaining, newRemaining = 1, 1
+			if matches[1] != "" {
+				oldRemaining, _ = strconv.Atoi(matches[1])
+			}
+			if matches[2] != "" {
+				newRemaining, _ = strconv.Atoi(matches[2])
+			}
+			current.hunks++
+		} else if current == nil {
+			// Text before the first file (ex. the message of a 'git format-patch')
+			continue
+		}
+
+		buf.WriteString(line)
+	}
+	flush()
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Patch does not change any files")
+	}
+
+	return files, nil
+}
+
+// hunkNumbers returns the hunk numbers (starting at 1) of every line of git's
+// verbose output that matches re
+func hunkNumbers(output string, re *regexp.Regexp) map[int]bool {
+	numbers := map[int]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		if matches := re.FindStringSubmatch(strings.TrimSpace(line)); matches != nil {
+			n, _ := strconv.Atoi(matches[1])
+			numbers[n] = true
+		}
+	}
+
+	return numbers
+}
+
+// selectHunks returns the content of a patch file with only the hunks (numbered
+// from 1) in keep
+func selectHunks(content []byte, keep map[int]bool) []byte {
+	var buf bytes.Buffer
+	n := 0
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		if hunkHeaderRegex.MatchString(line) {
+			n++
+		}
+
+		if n == 0 || keep[n] {
+			buf.WriteString(line)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// rejectPass applies the hunks of a patch file that apply, and rejects the others.
+// It returns the numbers of the hunks that applied, of those that applied at an
+// offset, and of those that were rejected
+func rejectPass(dir string, patchFile string, paths []string, hunks int, args ...string) (map[int]bool, map[int]bool, map[int]bool) {
+	output, _ := gitApply(dir, patchFile, append([]string{"--reject"}, args...)...)
+	for _, path := range paths {
+		os.Remove(filepath.Join(dir, path+".rej"))
+	}
+
+	applied := hunkNumbers(output, hunkAppliedRegex)
+	rejected := hunkNumbers(output, hunkRejectedRegex)
+
+	// Without any rejected hunks, git does not list the hunks that applied
+	if patchCleanRegex.MatchString(output) {
+		for n := 1; n <= hunks; n++ {
+			applied[n] = true
+		}
+	}
+
+	return applied, hunkNumbers(output, hunkOffsetRegex), rejected
+}
+
+func gitApply(dir string, patchFile string, args ...string) (string, error) {
+	cmd := exec.Command("git", append(append([]string{"-C", dir, "apply", "--verbose"}, args...), patchFile)...)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// applyPatchFile applies the changes to a single file, first as they are, then with
+// a three-way merge, and finally hunk by hunk with less context, rejecting the
+// hunks that still do not apply
+func applyPatchFile(repo *store.Repo, file patchFile) (HunkReport, error) {
+	report := HunkReport{}
+	hunks := file.hunks
+	if hunks == 0 {
+		// Ex. renames, mode changes, and binary patches
+		hunks = 1
+	}
+
+	tmp, err := ioutil.TempFile("", "redpanda-patch-*.diff")
+	if err != nil {
+		return report, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(file.content); err != nil {
+		tmp.Close()
+		return report, err
+	}
+	if err := tmp.Close(); err != nil {
+		return report, err
+	}
+
+	if output, err := gitApply(repo.Dir, tmp.Name()); err == nil {
+		report.Fuzzed = len(hunkNumbers(output, hunkOffsetRegex))
+		report.Clean = hunks - report.Fuzzed
+		return report, nil
+	}
+
+	// A three-way merge needs the blobs the patch was made from. If it conflicts,
+	// "ours" is what was staged before, which includes the changes of previous
+	// transformers
+	paths := file.paths()
+	if _, err := gitApply(repo.Dir, tmp.Name(), "--3way"); err == nil {
+		report.Fuzzed = hunks
+		return report, nil
+	}
+
+	cmd := exec.Command("git", append([]string{"-C", repo.Dir, "ls-files", "--unmerged", "--"}, paths...)...)
+	unmerged, err := cmd.Output()
+	if err != nil {
+		return report, err
+	}
+
+	if len(unmerged) > 0 {
+		cmd = exec.Command("git", append([]string{"-C", repo.Dir, "checkout", "--ours", "--"}, paths...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return report, fmt.Errorf("Failed to undo three-way merge: %w: %s", err, output)
+		}
+
+		cmd = exec.Command("git", append([]string{"-C", repo.Dir, "add", "--"}, paths...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return report, fmt.Errorf("Failed to undo three-way merge: %w: %s", err, output)
+		}
+	}
+
+	// Hunks that apply with all of their context are clean, unless they applied
+	// at an offset
+	applied, fuzzed, rejected := rejectPass(repo.Dir, tmp.Name(), paths, hunks)
+	if len(applied)+len(rejected) == 0 {
+		// The file could not be patched at all (ex. it does not exist)
+		report.Rejected = hunks
+		return report, nil
+	}
+
+	for n := range applied {
+		if fuzzed[n] {
+			report.Fuzzed++
+		} else {
+			report.Clean++
+		}
+	}
+
+	if len(rejected) == 0 {
+		return report, nil
+	}
+
+	// The hunks that were rejected get another chance, with less context
+	if err := ioutil.WriteFile(tmp.Name(), selectHunks(file.content, rejected), 0o644); err != nil {
+		return report, err
+	}
+
+	applied, _, stillRejected := rejectPass(repo.Dir, tmp.Name(), paths, len(rejected), "-C1")
+	report.Fuzzed += len(applied)
+	report.Rejected += len(stillRejected)
+	if len(applied)+len(stillRejected) == 0 {
+		report.Rejected += len(rejected)
+	}
+
+	return report, nil
+}
+
+// transformPatch applies a unified diff. Hunks that do not apply are reported
+// rather than failing the transformer, so a patch that only partially fits some
+// repositories can still be applied to the others
+func transformPatch(repo *store.Repo, transformer store.Transformer) (TransformerReport, error) {
+	report := TransformerReport{
+		Repo:        repo.Name,
+		Transformer: transformer.Name,
+		Matches:     map[string]int{},
+		Hunks:       map[string]HunkReport{},
+	}
+
+	files, err := splitPatch(transformer.Content)
+	if err != nil {
+		return report, err
+	}
+
+	for _, file := range files {
+		name := file.newPath
+		if name == "" {
+			name = file.oldPath
+		}
+
+		// Three-way merges stage their result, so changes outside of the scope of
+		// the transformer must not be attempted at all
+		paths := file.paths()
+		inScope, err := matchFiles(paths, transformer.Include, transformer.Exclude)
+		if err != nil {
+			return report, err
+		}
+		if len(inScope) != len(paths) {
+			continue
+		}
+
+		hunkReport, err := applyPatchFile(repo, file)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", name, err)
+		}
+
+		report.Hunks[name] = hunkReport
+	}
+
+	return report, nil
+}
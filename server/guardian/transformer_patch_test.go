@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// newGitRepo returns a repository in a temporary directory with a commit of files,
+// keyed by their path
+func newGitRepo(t *testing.T, files map[string]string) *store.Repo {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial commit"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, output)
+		}
+	}
+
+	return &store.Repo{Name: "hyperupcall/example", Dir: dir}
+}
+
+// numberedLines returns the lines "line <n>" for n in [from, to]
+func numberedLines(from int, to int) []string {
+	lines := []string{}
+	for n := from; n <= to; n++ {
+		lines = append(lines, fmt.Sprintf("line %d", n))
+	}
+
+	return lines
+}
+
+// lineHunk returns a hunk that changes "line <n>" to "LINE <n>", with three lines
+// of context on either side
+func lineHunk(n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@@ -%d,7 +%d,7 @@\n", n-3, n-3)
+	for _, line := range numberedLines(n-3, n-1) {
+		b.WriteString(" " + line + "\n")
+	}
+	fmt.Fprintf(&b, "-line %d\n+LINE %d\n", n, n)
+	for _, line := range numberedLines(n+1, n+3) {
+		b.WriteString(" " + line + "\n")
+	}
+
+	return b.String()
+}
+
+// upperLines returns a copy of lines with "line <n>" changed to "LINE <n>" for each
+// n in numbers
+func upperLines(lines []string, numbers ...int) []string {
+	result := append([]string{}, lines...)
+	for i, line := range result {
+		for _, n := range numbers {
+			if line == fmt.Sprintf("line %d", n) {
+				result[i] = strings.ToUpper(line)
+			}
+		}
+	}
+
+	return result
+}
+
+func TestTransformPatch(t *testing.T) {
+	patch := "--- a/file.txt\n+++ b/file.txt\n" + lineHunk(5) + lineHunk(25)
+	offset := append(append(numberedLines(1, 10), "new 1", "new 2"), numberedLines(11, 30)...)
+	changed := append(append(numberedLines(1, 24), "changed 25"), numberedLines(26, 30)...)
+
+	tests := []struct {
+		name    string
+		content []string
+		want    HunkReport
+		result  []string
+	}{
+		{"clean", numberedLines(1, 30), HunkReport{Clean: 2}, upperLines(numberedLines(1, 30), 5, 25)},
+		{"offset", offset, HunkReport{Clean: 1, Fuzzed: 1}, upperLines(offset, 5, 25)},
+		{"rejected hunk", changed, HunkReport{Clean: 1, Rejected: 1}, upperLines(changed, 5)},
+	}
+	for _, test := range tests {
+		repo := newGitRepo(t, map[string]string{"file.txt": strings.Join(test.content, "\n") + "\n"})
+
+		report, err := transformPatch(repo, store.Transformer{Name: "patch", Content: patch})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if got := report.Hunks["file.txt"]; got != test.want {
+			t.Errorf("%s: hunks = %+v, want %+v", test.name, got, test.want)
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(repo.Dir, "file.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Join(test.result, "\n") + "\n"; string(content) != want {
+			t.Errorf("%s: file.txt =\n%s\nwant:\n%s", test.name, content, want)
+		}
+	}
+}
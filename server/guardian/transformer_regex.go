@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// The content of a "regex" transformer is a JSON object of this shape. The
+// replacement may reference capture groups with $1 or ${name}
+type regexContent struct {
+	Pattern     string   `json:"pattern"`
+	Replacement string   `json:"replacement"`
+	Include     []string `json:"include"`
+	Exclude     []string `json:"exclude"`
+	Multiline   bool     `json:"multiline"`
+	DotAll      bool     `json:"dotAll"`
+	IgnoreCase  bool     `json:"ignoreCase"`
+}
+
+func parseRegexContent(content string) (regexContent, *regexp.Regexp, error) {
+	var c regexContent
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		return c, nil, fmt.Errorf("Failed to parse regex transformer content: %w", err)
+	}
+
+	if c.Pattern == "" {
+		return c, nil, fmt.Errorf("Regex transformer must have a pattern")
+	}
+
+	flags := ""
+	if c.Multiline {
+		flags += "m"
+	}
+	if c.DotAll {
+		flags += "s"
+	}
+	if c.IgnoreCase {
+		flags += "i"
+	}
+
+	pattern := c.Pattern
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return c, nil, err
+	}
+
+	return c, re, nil
+}
+
+func transformRegex(repo *store.Repo, transformer store.Transformer) error {
+	c, re, err := parseRegexContent(transformer.Content)
+	if err != nil {
+		return err
+	}
+
+	return rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+		return re.ReplaceAll(content, []byte(c.Replacement)), nil
+	})
+}
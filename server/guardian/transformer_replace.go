@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// The content of a "replace" transformer is a JSON object of this shape. Both
+// find and replace are literal strings. If maxOccurrences is positive, the
+// transformer fails (without touching the repository) when there are more matches
+// than that
+type replaceContent struct {
+	Find           string   `json:"find"`
+	Replace        string   `json:"replace"`
+	Include        []string `json:"include"`
+	Exclude        []string `json:"exclude"`
+	WholeWord      bool     `json:"wholeWord"`
+	IgnoreCase     bool     `json:"ignoreCase"`
+	MaxOccurrences int      `json:"maxOccurrences"`
+}
+
+func parseReplaceContent(content string) (replaceContent, *regexp.Regexp, error) {
+	var c replaceContent
+	if err := json.Unmarshal([]byte(content), &c); err != nil {
+		return c, nil, fmt.Errorf("Failed to parse replace transformer content: %w", err)
+	}
+
+	if c.Find == "" {
+		return c, nil, fmt.Errorf("Replace transformer must have a string to find")
+	}
+
+	pattern := regexp.QuoteMeta(c.Find)
+	if c.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	return c, regexp.MustCompile(pattern), nil
+}
+
+// isWordBoundary reports whether the match at content[start:end] is not directly
+// surrounded by word characters
+func isWordBoundary(content []byte, start int, end int) bool {
+	isWord := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRune(content[:start]); isWord(r) {
+			return false
+		}
+	}
+
+	if end < len(content) {
+		if r, _ := utf8.DecodeRune(content[end:]); isWord(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// replaceLiteral returns content with every match of re replaced by replacement,
+// along with the number of replacements made
+func replaceLiteral(content []byte, re *regexp.Regexp, replacement string, wholeWord bool) ([]byte, int) {
+	var buf bytes.Buffer
+	count := 0
+	last := 0
+
+	for _, loc := range re.FindAllIndex(content, -1) {
+		if wholeWord && !isWordBoundary(content, loc[0], loc[1]) {
+			continue
+		}
+
+		buf.Write(content[last:loc[0]])
+		buf.WriteString(replacement)
+		last = loc[1]
+		count++
+	}
+
+	if count == 0 {
+		return content, 0
+	}
+
+	buf.Write(content[last:])
+	return buf.Bytes(), count
+}
+
+func transformReplace(repo *store.Repo, transformer store.Transformer) error {
+	c, re, err := parseReplaceContent(transformer.Content)
+	if err != nil {
+		return err
+	}
+
+	if c.MaxOccurrences > 0 {
+		total := 0
+		if err := rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+			_, count := replaceLiteral(content, re, c.Replace, c.WholeWord)
+			total += count
+
+			return content, nil
+		}); err != nil {
+			return err
+		}
+
+		if total > c.MaxOccurrences {
+			return fmt.Errorf("Replace transformer '%s' found %d occurrences in %s, but at most %d are allowed", transformer.Name, total, repo.Name, c.MaxOccurrences)
+		}
+	}
+
+	return rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+		newContent, _ := replaceLiteral(content, re, c.Replace, c.WholeWord)
+		return newContent, nil
+	})
+}
@@ -0,0 +1,452 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/hyperupcall/redpanda/server/store"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"gopkg.in/yaml.v3"
+)
+
+// The content of a "starlark" transformer is a Starlark script. It runs in-process
+// with no access to anything but the repository, through the builtins below. There
+// is no load(), and scripts are limited in how many steps they may execute
+//
+//	repo                       name, owner, default_branch, tags, and variables
+//	files                      tracked files within the scope of the transformer
+//	glob(pattern)              files that match a glob
+//	exists(path)
+//	read_file(path)
+//	write_file(path, content)
+//	delete_file(path)
+//	re.match(pattern, s)       whether the pattern matches anywhere in s
+//	re.find_all(pattern, s)
+//	re.sub(pattern, repl, s)   repl may reference capture groups with $1 or ${name}
+//	json.encode(x), json.decode(s), json.indent(s)
+//	yaml.encode(x), yaml.decode(s)
+const starlarkMaxSteps = 100_000_000
+
+// starlarkEnv is everything a script has access to. Keeping it separate from git
+// means scripts can be run (and tested) against any directory
+type starlarkEnv struct {
+	repo  *store.Repo
+	meta  pluginRepo
+	files []string
+	print func(msg string)
+}
+
+func (env *starlarkEnv) path(name string) (string, error) {
+	return repoPath(env.repo, name)
+}
+
+func (env *starlarkEnv) builtins() starlark.StringDict {
+	files := make([]starlark.Value, 0, len(env.files))
+	for _, file := range env.files {
+		files = append(files, starlark.String(file))
+	}
+
+	tags := []starlark.Value{}
+	for _, tag := range env.meta.Tags {
+		tags = append(tags, starlark.String(tag))
+	}
+
+	// Dicts keep their insertion order, so the keys are sorted for it to be the
+	// same every time
+	keys := make([]string, 0, len(env.meta.Variables))
+	for key := range env.meta.Variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	variables := starlark.NewDict(len(keys))
+	for _, key := range keys {
+		variables.SetKey(starlark.String(key), starlark.String(env.meta.Variables[key]))
+	}
+
+	return starlark.StringDict{
+		"repo": starlarkstruct.FromStringDict(starlark.String("repo"), starlark.StringDict{
+			"name":           starlark.String(env.meta.Name),
+			"owner":          starlark.String(env.meta.Owner),
+			"default_branch": starlark.String(env.meta.DefaultBranch),
+			"tags":           starlark.NewList(tags),
+			"variables":      variables,
+		}),
+		"files":       starlark.NewList(files),
+		"glob":        starlark.NewBuiltin("glob", env.glob),
+		"exists":      starlark.NewBuiltin("exists", env.exists),
+		"read_file":   starlark.NewBuiltin("read_file", env.readFile),
+		"write_file":  starlark.NewBuiltin("write_file", env.writeFile),
+		"delete_file": starlark.NewBuiltin("delete_file", env.deleteFile),
+		"re": &starlarkstruct.Module{
+			Name: "re",
+			Members: starlark.StringDict{
+				"match":    starlark.NewBuiltin("re.match", starlarkReMatch),
+				"find_all": starlark.NewBuiltin("re.find_all", starlarkReFindAll),
+				"sub":      starlark.NewBuiltin("re.sub", starlarkReSub),
+			},
+		},
+		"json": json.Module,
+		"yaml": &starlarkstruct.Module{
+			Name: "yaml",
+			Members: starlark.StringDict{
+				"encode": starlark.NewBuiltin("yaml.encode", starlarkYamlEncode),
+				"decode": starlark.NewBuiltin("yaml.decode", starlarkYamlDecode),
+			},
+		},
+	}
+}
+
+func (env *starlarkEnv) glob(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern); err != nil {
+		return nil, err
+	}
+
+	if !doublestar.ValidatePattern(pattern) {
+		return nil, fmt.Errorf("%s: invalid pattern: %s", fn.Name(), pattern)
+	}
+
+	matches := []starlark.Value{}
+	for _, file := range env.files {
+		if ok, _ := doublestar.Match(pattern, file); ok {
+			matches = append(matches, starlark.String(file))
+		}
+	}
+
+	return starlark.NewList(matches), nil
+}
+
+func (env *starlarkEnv) exists(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &name); err != nil {
+		return nil, err
+	}
+
+	path, err := env.path(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	_, err = os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return starlark.False, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return starlark.True, nil
+}
+
+func (env *starlarkEnv) readFile(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &name); err != nil {
+		return nil, err
+	}
+
+	path, err := env.path(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return starlark.String(content), nil
+}
+
+func (env *starlarkEnv) writeFile(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, content string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &name, "content", &content); err != nil {
+		return nil, err
+	}
+
+	if err := applyPluginEdit(env.repo, pluginEdit{Path: name, Content: content}); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return starlark.None, nil
+}
+
+func (env *starlarkEnv) deleteFile(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &name); err != nil {
+		return nil, err
+	}
+
+	if err := applyPluginEdit(env.repo, pluginEdit{Path: name, Delete: true}); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return starlark.None, nil
+}
+
+func starlarkRegexp(fn *starlark.Builtin, pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return re, nil
+}
+
+func starlarkReMatch(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+
+	re, err := starlarkRegexp(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Bool(re.MatchString(s)), nil
+}
+
+func starlarkReFindAll(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "s", &s); err != nil {
+		return nil, err
+	}
+
+	re, err := starlarkRegexp(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []starlark.Value{}
+	for _, match := range re.FindAllString(s, -1) {
+		matches = append(matches, starlark.String(match))
+	}
+
+	return starlark.NewList(matches), nil
+}
+
+func starlarkReSub(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, repl, s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "pattern", &pattern, "repl", &repl, "s", &s); err != nil {
+		return nil, err
+	}
+
+	re, err := starlarkRegexp(fn, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.String(re.ReplaceAllString(s, repl)), nil
+}
+
+// starlarkToNode converts a Starlark value to a YAML node, keeping the order of
+// dictionary keys
+func starlarkToNode(value starlark.Value) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	case starlark.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(bool(v))}, nil
+	case starlark.Int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: v.String()}, nil
+	case starlark.Float:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(float64(v), 'g', -1, 64)}, nil
+	case starlark.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(v)}, nil
+	case *starlark.Dict:
+		node := newMappingNode()
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("Keys must be strings, not %s", item[0].Type())
+			}
+
+			child, err := starlarkToNode(item[1])
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, newKeyNode(string(key)), child)
+		}
+
+		return node, nil
+	case starlark.Indexable:
+		node := newSequenceNode()
+		for i := 0; i < v.Len(); i++ {
+			child, err := starlarkToNode(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			node.Content = append(node.Content, child)
+		}
+
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("Cannot encode value of type %s", value.Type())
+}
+
+// nodeToStarlark converts a YAML node to a Starlark value
+func nodeToStarlark(node *yaml.Node) (starlark.Value, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return starlark.None, nil
+		}
+
+		return nodeToStarlark(node.Content[0])
+	case yaml.AliasNode:
+		return nodeToStarlark(node.Alias)
+	case yaml.MappingNode:
+		dict := starlark.NewDict(len(node.Content) / 2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := nodeToStarlark(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			if err := dict.SetKey(starlark.String(node.Content[i].Value), value); err != nil {
+				return nil, err
+			}
+		}
+
+		return dict, nil
+	case yaml.SequenceNode:
+		items := make([]starlark.Value, 0, len(node.Content))
+		for _, child := range node.Content {
+			item, err := nodeToStarlark(child)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		return starlark.NewList(items), nil
+	case yaml.ScalarNode:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		switch v := value.(type) {
+		case nil:
+			return starlark.None, nil
+		case bool:
+			return starlark.Bool(v), nil
+		case int:
+			return starlark.MakeInt(v), nil
+		case float64:
+			return starlark.Float(v), nil
+		}
+
+		return starlark.String(node.Value), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported YAML node")
+}
+
+func starlarkYamlEncode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "x", &value); err != nil {
+		return nil, err
+	}
+
+	node, err := starlarkToNode(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return starlark.String(buf.String()), nil
+}
+
+func starlarkYamlDecode(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "s", &s); err != nil {
+		return nil, err
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &node); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	value, err := nodeToStarlark(&node)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+	}
+
+	return value, nil
+}
+
+// runStarlark executes a script with the builtins of env
+func runStarlark(name string, script string, env *starlarkEnv) error {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			if env.print != nil {
+				env.print(msg)
+			}
+		},
+	}
+	thread.SetMaxExecutionSteps(starlarkMaxSteps)
+
+	if _, err := starlark.ExecFile(thread, name+".star", script, env.builtins()); err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			return fmt.Errorf("%s", evalErr.Backtrace())
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func transformStarlark(g *Guardian, repo *store.Repo, transformer store.Transformer) error {
+	files, err := transformerFiles(repo, transformer, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	branch, err := defaultBranch(repo.Dir)
+	if err != nil {
+		return err
+	}
+
+	env := &starlarkEnv{
+		repo: repo,
+		meta: pluginRepo{
+			Name:          repo.Name,
+			Owner:         repoOwner(repo.Name),
+			Dir:           repo.Dir,
+			DefaultBranch: branch,
+			Tags:          repo.Tags,
+			Variables:     repo.Variables,
+		},
+		files: files,
+		print: func(msg string) {
+			g.logger.Info(fmt.Sprintf("%s (%s): %s", transformer.Name, repo.Name, msg))
+		},
+	}
+
+	return runStarlark(transformer.Name, transformer.Content, env)
+}
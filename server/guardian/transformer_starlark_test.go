@@ -0,0 +1,218 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperupcall/redpanda/server/store"
+)
+
+// newStarlarkEnv returns an environment for a repository in a temporary directory
+// that contains files, keyed by their path
+func newStarlarkEnv(t *testing.T, files map[string]string) *starlarkEnv {
+	t.Helper()
+
+	dir := t.TempDir()
+	names := []string{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	repo := &store.Repo{Name: "hyperupcall/example", Dir: dir}
+
+	return &starlarkEnv{
+		repo: repo,
+		meta: pluginRepo{
+			Name:          repo.Name,
+			Owner:         repoOwner(repo.Name),
+			Dir:           dir,
+			DefaultBranch: "main",
+			Tags:          []string{"go"},
+			Variables:     map[string]string{"license": "MIT", "team": "core", "ci": "github"},
+		},
+		files: names,
+	}
+}
+
+func readRepoFile(t *testing.T, env *starlarkEnv, name string) string {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(filepath.Join(env.repo.Dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestStarlarkFiles(t *testing.T) {
+	env := newStarlarkEnv(t, map[string]string{"README.md": "# Example\n"})
+
+	script := `
+def main():
+    content = read_file("README.md")
+    write_file("README.md", content + "More\n")
+    write_file("docs/new.md", "New\n")
+    if not exists("docs/new.md") or exists("missing.md"):
+        fail("exists")
+
+main()
+`
+	if err := runStarlark("test", script, env); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readRepoFile(t, env, "README.md"); got != "# Example\nMore\n" {
+		t.Errorf("README.md = %q", got)
+	}
+	if got := readRepoFile(t, env, "docs/new.md"); got != "New\n" {
+		t.Errorf("docs/new.md = %q", got)
+	}
+
+	if err := runStarlark("test", `delete_file("docs/new.md")`, env); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(env.repo.Dir, "docs/new.md")); !os.IsNotExist(err) {
+		t.Errorf("docs/new.md was not deleted")
+	}
+}
+
+func TestStarlarkRepo(t *testing.T) {
+	env := newStarlarkEnv(t, map[string]string{"a.go": "", "b/c.go": "", "d.md": ""})
+
+	script := `
+def main():
+    if repo.name != "hyperupcall/example" or repo.owner != "hyperupcall":
+        fail("name")
+    if repo.default_branch != "main" or repo.tags != ["go"]:
+        fail("branch or tags")
+    if repo.variables["license"] != "MIT":
+        fail("variables")
+    if list(repo.variables) != ["ci", "license", "team"]:
+        fail("variables order: %s" % list(repo.variables))
+    if sorted(glob("**/*.go")) != ["a.go", "b/c.go"]:
+        fail("glob: %s" % glob("**/*.go"))
+    if len(files) != 3:
+        fail("files")
+
+main()
+`
+	if err := runStarlark("test", script, env); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStarlarkModules(t *testing.T) {
+	env := newStarlarkEnv(t, nil)
+
+	script := `
+def main():
+    if not re.match("b+", "abbc") or re.match("^b", "abbc"):
+        fail("re.match")
+    if re.find_all("[0-9]+", "a1b22c333") != ["1", "22", "333"]:
+        fail("re.find_all")
+    if re.sub("(\\w+)@(\\w+)", "$2 at $1", "me@home") != "home at me":
+        fail("re.sub")
+    if json.decode('{"a": [1, 2]}') != {"a": [1, 2]}:
+        fail("json.decode")
+    if yaml.decode("a: 1\nb: [x, true]\n") != {"a": 1, "b": ["x", True]}:
+        fail("yaml.decode")
+    if yaml.encode({"z": 1, "a": [None]}) != "z: 1\na:\n  - null\n":
+        fail("yaml.encode: %r" % yaml.encode({"z": 1, "a": [None]}))
+
+main()
+`
+	if err := runStarlark("test", script, env); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStarlarkErrors(t *testing.T) {
+	env := newStarlarkEnv(t, nil)
+
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{`fail("oops")`, "oops"},
+		{`read_file("missing.md")`, "no such file"},
+		{`re.match("(", "")`, "re.match"},
+		{`load("other.star", "x")`, "load not implemented"},
+		{"def f():\n    for i in range(1000000):\n        for j in range(1000000):\n            pass\n\nf()", "too many steps"},
+	}
+	for _, test := range tests {
+		err := runStarlark("test", test.script, env)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: error = %v, want %q", test.script, err, test.err)
+		}
+	}
+}
+
+func TestStarlarkPathEscape(t *testing.T) {
+	outside := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := newStarlarkEnv(t, map[string]string{"inside.md": "inside\n", ".git/config": ""})
+	links := map[string]string{
+		"out":    outside,
+		"secret": filepath.Join(outside, "secret"),
+		"broken": filepath.Join(outside, "missing"),
+		"git":    ".git",
+		"in":     "inside.md",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(env.repo.Dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rejected := []string{
+		`read_file("/etc/passwd")`,
+		`read_file("../secret")`,
+		`read_file("a/../../secret")`,
+		`read_file(".git/config")`,
+		`read_file("secret")`,
+		`read_file("out/secret")`,
+		`exists("out/secret")`,
+		`write_file("out/new", "x")`,
+		`write_file("out/dir/new", "x")`,
+		`write_file("secret", "x")`,
+		`write_file("broken", "x")`,
+		`write_file("git/config", "x")`,
+		`delete_file("out/secret")`,
+	}
+	for _, script := range rejected {
+		if err := runStarlark("test", script, env); err == nil {
+			t.Errorf("%s: expected an error", script)
+		}
+	}
+
+	if content, err := ioutil.ReadFile(filepath.Join(outside, "secret")); err != nil || string(content) != "secret\n" {
+		t.Errorf("secret was modified: %q, %v", content, err)
+	}
+	for _, name := range []string{"new", "dir", "missing"} {
+		if _, err := os.Lstat(filepath.Join(outside, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was created outside of the repository", name)
+		}
+	}
+
+	// Links within the repository are followed
+	if err := runStarlark("test", `write_file("in", read_file("in") + "more\n")`, env); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRepoFile(t, env, "inside.md"); got != "inside\nmore\n" {
+		t.Errorf("inside.md = %q", got)
+	}
+}
@@ -0,0 +1,443 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hyperupcall/redpanda/server/store"
+	"gopkg.in/yaml.v3"
+)
+
+// The content of a "structured-edit" transformer is a JSON object of this shape.
+// Files are parsed according to Format, or their extension if it is empty
+type structuredEditContent struct {
+	Format     string                `json:"format"`
+	Include    []string              `json:"include"`
+	Exclude    []string              `json:"exclude"`
+	Operations []structuredOperation `json:"operations"`
+}
+
+// Op is one of "set", "delete", "append" (to an array), or "merge" (an object
+// into an object). Unless Create is true, every part of the path must already
+// exist (for "set", that includes the key being set)
+type structuredOperation struct {
+	Op     string          `json:"op"`
+	Path   string          `json:"path"`
+	Value  json.RawMessage `json:"value"`
+	Create bool            `json:"create"`
+}
+
+// A segment of a path expression like 'jobs.build.steps[0]["uses"]'. Exactly one
+// of key or index is meaningful
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func parsePath(path string) ([]pathSegment, error) {
+	segments := []pathSegment{}
+
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			if i == 0 || i == len(path)-1 {
+				return nil, fmt.Errorf("Path '%s' must not start or end with a '.'", path)
+			}
+			if path[i+1] == '.' || path[i+1] == '[' {
+				return nil, fmt.Errorf("Path '%s' has an empty key", path)
+			}
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("Path '%s' has an unterminated '['", path)
+			}
+			inner := path[i+1 : i+end]
+
+			if strings.HasPrefix(inner, `"`) {
+				// Quoted keys may contain a ']', so find the actual closing quote
+				quoted, err := strconv.QuotedPrefix(path[i+1:])
+				if err != nil || !strings.HasPrefix(path[i+1+len(quoted):], "]") {
+					return nil, fmt.Errorf("Path '%s' has an invalid quoted key", path)
+				}
+
+				key, _ := strconv.Unquote(quoted)
+				segments = append(segments, pathSegment{key: key})
+				i += len(quoted) + 2
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("Path '%s' has an invalid index '%s'", path, inner)
+				}
+
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+				i += end + 1
+			}
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end == -1 {
+				end = len(path) - i
+			}
+
+			segments = append(segments, pathSegment{key: path[i : i+end]})
+			i += end
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("Path must not be empty")
+	}
+
+	return segments, nil
+}
+
+func newMappingNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func newSequenceNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+}
+
+func newKeyNode(key string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+}
+
+// mappingValue returns the index in node.Content of the value for key, or -1
+func mappingValue(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// lookupChild returns the child of node at segment. If it does not exist and create
+// is true, it is created with the kind of the next segment (if there is one)
+func lookupChild(node *yaml.Node, segment pathSegment, next *pathSegment, create bool) (*yaml.Node, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	newChild := func() *yaml.Node {
+		if next != nil && next.isIndex {
+			return newSequenceNode()
+		}
+
+		return newMappingNode()
+	}
+
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("Cannot index into a value that is not an array")
+		}
+
+		if segment.index < len(node.Content) {
+			return node.Content[segment.index], nil
+		}
+
+		if !create || segment.index != len(node.Content) {
+			return nil, fmt.Errorf("Index %d is out of bounds", segment.index)
+		}
+
+		child := newChild()
+		node.Content = append(node.Content, child)
+		return child, nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("Cannot get key '%s' of a value that is not an object", segment.key)
+	}
+
+	if i := mappingValue(node, segment.key); i != -1 {
+		return node.Content[i], nil
+	}
+
+	if !create {
+		return nil, fmt.Errorf("Key '%s' does not exist", segment.key)
+	}
+
+	child := newChild()
+	node.Content = append(node.Content, newKeyNode(segment.key), child)
+	return child, nil
+}
+
+// lookupParent returns the node that contains the last segment of the path
+func lookupParent(root *yaml.Node, segments []pathSegment, create bool) (*yaml.Node, error) {
+	node := root
+
+	for i, segment := range segments[:len(segments)-1] {
+		child, err := lookupChild(node, segment, &segments[i+1], create)
+		if err != nil {
+			return nil, err
+		}
+
+		node = child
+	}
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	return node, nil
+}
+
+// setChild replaces (or if create is true, adds) the child of node at segment
+func setChild(node *yaml.Node, segment pathSegment, value *yaml.Node, create bool) error {
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("Cannot index into a value that is not an array")
+		}
+
+		if segment.index < len(node.Content) {
+			node.Content[segment.index] = value
+			return nil
+		}
+
+		if !create || segment.index != len(node.Content) {
+			return fmt.Errorf("Index %d is out of bounds", segment.index)
+		}
+
+		node.Content = append(node.Content, value)
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("Cannot set key '%s' of a value that is not an object", segment.key)
+	}
+
+	if i := mappingValue(node, segment.key); i != -1 {
+		// Keep the comments and style (ex. TOML inline tables) of the old value
+		old := node.Content[i]
+		value.HeadComment = old.HeadComment
+		value.LineComment = old.LineComment
+		if old.Kind == value.Kind && old.Style == yaml.FlowStyle {
+			value.Style = yaml.FlowStyle
+		}
+		node.Content[i] = value
+		return nil
+	}
+
+	if !create {
+		return fmt.Errorf("Key '%s' does not exist", segment.key)
+	}
+
+	node.Content = append(node.Content, newKeyNode(segment.key), value)
+	return nil
+}
+
+func deleteChild(node *yaml.Node, segment pathSegment) error {
+	if segment.isIndex {
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("Cannot index into a value that is not an array")
+		}
+
+		if segment.index >= len(node.Content) {
+			return fmt.Errorf("Index %d is out of bounds", segment.index)
+		}
+
+		node.Content = append(node.Content[:segment.index], node.Content[segment.index+1:]...)
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("Cannot delete key '%s' of a value that is not an object", segment.key)
+	}
+
+	i := mappingValue(node, segment.key)
+	if i == -1 {
+		return fmt.Errorf("Key '%s' does not exist", segment.key)
+	}
+
+	node.Content = append(node.Content[:i-1], node.Content[i+1:]...)
+	return nil
+}
+
+// mergeNodes recursively merges the keys of src into dst
+func mergeNodes(dst *yaml.Node, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		j := mappingValue(dst, key.Value)
+		if j == -1 {
+			dst.Content = append(dst.Content, key, value)
+		} else if dst.Content[j].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeNodes(dst.Content[j], value)
+		} else {
+			dst.Content[j] = value
+		}
+	}
+}
+
+func valueNode(value json.RawMessage) (*yaml.Node, error) {
+	if len(value) == 0 {
+		return nil, fmt.Errorf("Operation requires a value")
+	}
+
+	return parseJSONNode(value, false)
+}
+
+func applyStructuredOperation(root *yaml.Node, operation structuredOperation) error {
+	segments, err := parsePath(operation.Path)
+	if err != nil {
+		return err
+	}
+	last := segments[len(segments)-1]
+
+	switch operation.Op {
+	case "set":
+		value, err := valueNode(operation.Value)
+		if err != nil {
+			return err
+		}
+
+		parent, err := lookupParent(root, segments, operation.Create)
+		if err != nil {
+			return err
+		}
+
+		return setChild(parent, last, value, operation.Create)
+	case "delete":
+		parent, err := lookupParent(root, segments, false)
+		if err != nil {
+			return err
+		}
+
+		return deleteChild(parent, last)
+	case "append":
+		value, err := valueNode(operation.Value)
+		if err != nil {
+			return err
+		}
+
+		parent, err := lookupParent(root, segments, operation.Create)
+		if err != nil {
+			return err
+		}
+
+		array, err := lookupChild(parent, last, &pathSegment{isIndex: true}, operation.Create)
+		if err != nil {
+			return err
+		}
+		if array.Kind != yaml.SequenceNode {
+			return fmt.Errorf("Cannot append to a value that is not an array")
+		}
+
+		array.Content = append(array.Content, value)
+		return nil
+	case "merge":
+		value, err := valueNode(operation.Value)
+		if err != nil {
+			return err
+		}
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("Merge requires the value to be an object")
+		}
+
+		parent, err := lookupParent(root, segments, operation.Create)
+		if err != nil {
+			return err
+		}
+
+		object, err := lookupChild(parent, last, nil, operation.Create)
+		if err != nil {
+			return err
+		}
+		if object.Kind != yaml.MappingNode {
+			return fmt.Errorf("Cannot merge into a value that is not an object")
+		}
+
+		mergeNodes(object, value)
+		return nil
+	default:
+		return fmt.Errorf("Unknown structured-edit operation: %s", operation.Op)
+	}
+}
+
+func structuredFormat(format string, file string) (string, error) {
+	if format != "" {
+		return format, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	}
+
+	return "", fmt.Errorf("Unable to infer format from file extension (set 'format' explicitly)")
+}
+
+// editStructured applies the operations to a document
+func editStructured(codec structuredCodec, content []byte, operations []structuredOperation) ([]byte, error) {
+	root, err := codec.Decode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encoding is not always a perfect round-trip, so if the operations turn out
+	// not to change anything, the file is left untouched
+	original, err := codec.Encode(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, operation := range operations {
+		if err := applyStructuredOperation(root, operation); err != nil {
+			return nil, fmt.Errorf("Failed to %s '%s': %w", operation.Op, operation.Path, err)
+		}
+	}
+
+	newContent, err := codec.Encode(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(newContent, original) {
+		return content, nil
+	}
+
+	return newContent, nil
+}
+
+func transformStructuredEdit(repo *store.Repo, transformer store.Transformer) error {
+	var c structuredEditContent
+	if err := json.Unmarshal([]byte(transformer.Content), &c); err != nil {
+		return fmt.Errorf("Failed to parse structured-edit transformer content: %w", err)
+	}
+
+	if len(c.Include) == 0 {
+		return fmt.Errorf("Structured-edit transformer must include at least one glob")
+	}
+
+	return rewriteFiles(repo, transformer, c.Include, c.Exclude, func(file string, content []byte) ([]byte, error) {
+		format, err := structuredFormat(c.Format, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var codec structuredCodec
+		switch format {
+		case "json":
+			codec = &jsonCodec{}
+		case "yaml":
+			codec = &yamlCodec{}
+		case "toml":
+			codec = &tomlCodec{}
+		default:
+			return nil, fmt.Errorf("Unknown structured-edit format: %s", format)
+		}
+
+		return editStructured(codec, content, c.Operations)
+	})
+}
@@ -0,0 +1,189 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const packageJSON = `{
+  "name": "example",
+  "keywords": ["a", "b"],
+  "scripts": {
+    "test": "jest"
+  },
+  "engines": {"node": ">=18"}
+}
+`
+
+const workflowYAML = `# Runs the tests
+name: CI
+
+on:
+  push:
+    branches: [main]
+
+jobs:
+  test:
+    runs-on: ubuntu-latest # The default
+    steps:
+      - uses: actions/checkout@v3
+`
+
+const cargoTOML = `# The manifest of the example crate
+
+# About the package
+[package]
+name = "example"
+keywords = ["a", "b"]
+authors = [
+    "a",
+]
+
+[dependencies]
+serde = "1.0" # Serialization
+`
+
+func TestEditStructured(t *testing.T) {
+	tests := []struct {
+		name       string
+		codec      structuredCodec
+		content    string
+		operations string
+		want       string
+	}{
+		{
+			name:       "json set",
+			codec:      &jsonCodec{},
+			content:    packageJSON,
+			operations: `[{"op": "set", "path": "scripts.test", "value": "vitest"}, {"op": "set", "path": "keywords", "value": ["c"]}]`,
+			want:       "{\n  \"name\": \"example\",\n  \"keywords\": [\"c\"],\n  \"scripts\": {\n    \"test\": \"vitest\"\n  },\n  \"engines\": {\"node\": \">=18\"}\n}\n",
+		},
+		{
+			name:       "json delete",
+			codec:      &jsonCodec{},
+			content:    packageJSON,
+			operations: `[{"op": "delete", "path": "scripts"}, {"op": "delete", "path": "keywords[0]"}]`,
+			want:       "{\n  \"name\": \"example\",\n  \"keywords\": [\"b\"],\n  \"engines\": {\"node\": \">=18\"}\n}\n",
+		},
+		{
+			name:       "json append",
+			codec:      &jsonCodec{},
+			content:    packageJSON,
+			operations: `[{"op": "append", "path": "keywords", "value": "c"}, {"op": "append", "path": "files", "value": "dist", "create": true}]`,
+			want:       "{\n  \"name\": \"example\",\n  \"keywords\": [\"a\", \"b\", \"c\"],\n  \"scripts\": {\n    \"test\": \"jest\"\n  },\n  \"engines\": {\"node\": \">=18\"},\n  \"files\": [\n    \"dist\"\n  ]\n}\n",
+		},
+		{
+			name:       "json merge",
+			codec:      &jsonCodec{},
+			content:    packageJSON,
+			operations: `[{"op": "merge", "path": "scripts", "value": {"lint": "eslint"}}, {"op": "merge", "path": "engines", "value": {"npm": ">=9"}}]`,
+			want:       "{\n  \"name\": \"example\",\n  \"keywords\": [\"a\", \"b\"],\n  \"scripts\": {\n    \"test\": \"jest\",\n    \"lint\": \"eslint\"\n  },\n  \"engines\": {\"node\": \">=18\", \"npm\": \">=9\"}\n}\n",
+		},
+		{
+			name:       "compact json",
+			codec:      &jsonCodec{},
+			content:    `{"a":[1,2],"b":{"c":true}}`,
+			operations: `[{"op": "set", "path": "b.c", "value": false}]`,
+			want:       `{"a":[1,2],"b":{"c":false}}`,
+		},
+		{
+			name:       "yaml set",
+			codec:      &yamlCodec{},
+			content:    workflowYAML,
+			operations: `[{"op": "set", "path": "jobs.test.runs-on", "value": "ubuntu-22.04"}]`,
+			want:       "# Runs the tests\nname: CI\n\non:\n  push:\n    branches: [main]\n\njobs:\n  test:\n    runs-on: ubuntu-22.04 # The default\n    steps:\n      - uses: actions/checkout@v3\n",
+		},
+		{
+			name:       "yaml delete",
+			codec:      &yamlCodec{},
+			content:    workflowYAML,
+			operations: `[{"op": "delete", "path": "on"}]`,
+			want:       "# Runs the tests\nname: CI\n\njobs:\n  test:\n    runs-on: ubuntu-latest # The default\n    steps:\n      - uses: actions/checkout@v3\n",
+		},
+		{
+			name:       "yaml append",
+			codec:      &yamlCodec{},
+			content:    workflowYAML,
+			operations: `[{"op": "append", "path": "jobs.test.steps", "value": {"run": "make test"}}, {"op": "append", "path": "on.push.branches", "value": "next"}]`,
+			want:       "# Runs the tests\nname: CI\n\non:\n  push:\n    branches: [main, next]\n\njobs:\n  test:\n    runs-on: ubuntu-latest # The default\n    steps:\n      - uses: actions/checkout@v3\n      - run: make test\n",
+		},
+		{
+			name:       "yaml merge",
+			codec:      &yamlCodec{},
+			content:    workflowYAML,
+			operations: `[{"op": "merge", "path": "on", "value": {"pull_request": {"branches": ["main"]}}}]`,
+			want:       "# Runs the tests\nname: CI\n\non:\n  push:\n    branches: [main]\n  pull_request:\n    branches:\n      - main\n\njobs:\n  test:\n    runs-on: ubuntu-latest # The default\n    steps:\n      - uses: actions/checkout@v3\n",
+		},
+		{
+			name:       "toml set",
+			codec:      &tomlCodec{},
+			content:    cargoTOML,
+			operations: `[{"op": "set", "path": "dependencies.serde", "value": "1.1"}, {"op": "set", "path": "package.edition", "value": "2021", "create": true}]`,
+			want:       "# The manifest of the example crate\n\n# About the package\n[package]\nname = \"example\"\nkeywords = [\"a\", \"b\"]\nauthors = [\n    \"a\",\n]\nedition = \"2021\"\n\n[dependencies]\nserde = \"1.1\" # Serialization\n",
+		},
+		{
+			name:       "toml delete",
+			codec:      &tomlCodec{},
+			content:    cargoTOML,
+			operations: `[{"op": "delete", "path": "package"}, {"op": "delete", "path": "dependencies.serde"}]`,
+			want:       "# The manifest of the example crate\n\n[dependencies]\n",
+		},
+		{
+			name:       "toml delete the first table",
+			codec:      &tomlCodec{},
+			content:    "# The manifest\n[package]\nname = \"example\"\n\n[dependencies]\nserde = \"1.0\"\n",
+			operations: `[{"op": "delete", "path": "package"}]`,
+			want:       "# The manifest\n[dependencies]\nserde = \"1.0\"\n",
+		},
+		{
+			name:       "toml append",
+			codec:      &tomlCodec{},
+			content:    cargoTOML,
+			operations: `[{"op": "append", "path": "package.keywords", "value": "c"}, {"op": "append", "path": "package.authors", "value": "b"}]`,
+			want:       "# The manifest of the example crate\n\n# About the package\n[package]\nname = \"example\"\nkeywords = [\"a\", \"b\", \"c\"]\nauthors = [\n    \"a\",\n    \"b\",\n]\n\n[dependencies]\nserde = \"1.0\" # Serialization\n",
+		},
+		{
+			name:       "toml merge",
+			codec:      &tomlCodec{},
+			content:    cargoTOML,
+			operations: `[{"op": "merge", "path": "dependencies", "value": {"tokio": "1"}}, {"op": "merge", "path": "profile", "value": {"release": {"lto": true}}, "create": true}]`,
+			want:       "# The manifest of the example crate\n\n# About the package\n[package]\nname = \"example\"\nkeywords = [\"a\", \"b\"]\nauthors = [\n    \"a\",\n]\n\n[dependencies]\nserde = \"1.0\" # Serialization\ntokio = \"1\"\n\n[profile.release]\nlto = true\n",
+		},
+	}
+	for _, test := range tests {
+		var operations []structuredOperation
+		if err := json.Unmarshal([]byte(test.operations), &operations); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := editStructured(test.codec, []byte(test.content), operations)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEditStructuredUnchanged(t *testing.T) {
+	tests := []struct {
+		codec   structuredCodec
+		content string
+		path    string
+		value   string
+	}{
+		{&jsonCodec{}, packageJSON, "name", `"example"`},
+		{&yamlCodec{}, workflowYAML, "name", `"CI"`},
+		{&tomlCodec{}, cargoTOML, "package.name", `"example"`},
+	}
+	for _, test := range tests {
+		operations := []structuredOperation{{Op: "set", Path: test.path, Value: json.RawMessage(test.value)}}
+
+		got, err := editStructured(test.codec, []byte(test.content), operations)
+		if err != nil || string(got) != test.content {
+			t.Errorf("%s was changed: %v\n%s", test.path, err, got)
+		}
+	}
+}
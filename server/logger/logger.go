@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
 type Logger interface {
@@ -20,6 +21,11 @@ type FileLogger struct {
 }
 
 func New(filePath string) FileLogger {
+	// The default log file is in the data directory, which may not exist yet
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		panic(err)
+	}
+
 	writer, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
 	if err != nil {
 		panic(err)
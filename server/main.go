@@ -1,11 +1,24 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/hyperupcall/redpanda/server/config"
 	"github.com/hyperupcall/redpanda/server/serve"
 	"github.com/hyperupcall/redpanda/server/store"
 )
 
 func main() {
-	store := store.New()
-	serve.Serve(&store)
+	config, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalln(err)
+	}
+
+	store := store.New(config.DataFile)
+	serve.Serve(&store, config)
 }
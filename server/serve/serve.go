@@ -1,18 +1,37 @@
 package serve
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hyperupcall/redpanda/server/config"
 	guardian "github.com/hyperupcall/redpanda/server/guardian"
 	"github.com/hyperupcall/redpanda/server/store"
 )
 
+// hasError responds with err, if there is one. For errors of an action in a
+// repository, the repository and step are included
 func hasError(ctx *gin.Context, err error) bool {
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		response := gin.H{"error": err.Error()}
+
+		var repoErr *guardian.RepoError
+		if errors.As(err, &repoErr) {
+			response["repo"] = repoErr.Repo
+		}
+
+		var stepErr *guardian.StepError
+		if errors.As(err, &stepErr) {
+			response["step"] = stepErr.Step
+			if stepErr.Stderr != "" {
+				response["stderr"] = stepErr.Stderr
+			}
+		}
+
+		ctx.JSON(http.StatusBadRequest, response)
 		return true
 	}
 
@@ -23,49 +42,87 @@ func returnSuccess(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-func Serve(store *store.Store) {
+// These are named here, since the store package is shadowed within Serve
+type (
+	host     = store.Host
+	identity = store.CommitIdentity
+)
+
+func Serve(store *store.Store, config config.Config) {
 	r := gin.Default()
-	g := guardian.New(store)
+	g := guardian.New(store, config)
 
 	r.POST("/api/action/apply", func(ctx *gin.Context) {
 		type Schema struct {
-			Transaction string `json:"transaction" binding:"required"`
+			Transaction     string `json:"transaction" binding:"required"`
+			Verify          bool   `json:"verify"`
+			ContinueOnError bool   `json:"continueOnError"`
 		}
 		var data Schema
 		if err := ctx.BindJSON(&data); err != nil {
 			return
 		}
 
-		content, err := g.ActionApply(data.Transaction)
+		result, err := g.ActionApply(data.Transaction, data.Verify, data.ContinueOnError)
 		if hasError(ctx, err) {
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"contents": content})
+		ctx.JSON(http.StatusOK, result)
 	})
 
 	r.POST("/api/action/refresh", func(ctx *gin.Context) {
+		type Schema struct {
+			Transaction     string `json:"transaction" binding:"required"`
+			Verify          bool   `json:"verify"`
+			ContinueOnError bool   `json:"continueOnError"`
+		}
+		var data Schema
+		if err := ctx.BindJSON(&data); err != nil {
+			return
+		}
+
+		result, err := g.ActionRefresh(data.Transaction, data.Verify, data.ContinueOnError)
+		if hasError(ctx, err) {
+			return
+		}
+
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/api/action/summary", func(ctx *gin.Context) {
 		type Schema struct {
 			Transaction string `json:"transaction" binding:"required"`
+			Format      string `json:"format"`
 		}
 		var data Schema
 		if err := ctx.BindJSON(&data); err != nil {
 			return
 		}
 
-		content, err := g.ActionRefresh(data.Transaction)
+		summary, err := g.ActionSummary(data.Transaction)
+		if hasError(ctx, err) {
+			return
+		}
+
+		if data.Format == "json" {
+			ctx.JSON(http.StatusOK, summary)
+			return
+		}
+
+		content, err := guardian.FormatSummary(summary, data.Format)
 		if hasError(ctx, err) {
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"contents": content})
+		ctx.String(http.StatusOK, content)
 	})
 
 	r.POST("/api/action/commit", func(ctx *gin.Context) {
 
 		type Schema struct {
 			Transaction   string `json:"transaction" binding:"required"`
-			CommitMessage string `json:commitMessage" binding:"required"`
+			CommitMessage string `json:"commitMessage" binding:"required"`
 		}
 		var data Schema
 		if err := ctx.BindJSON(&data); err != nil {
@@ -83,20 +140,20 @@ func Serve(store *store.Store) {
 
 	r.POST("/api/action/push", func(ctx *gin.Context) {
 		type Schema struct {
-			Transaction string `json:"transaction" binding:"required"`
+			Transaction     string `json:"transaction" binding:"required"`
+			ContinueOnError bool   `json:"continueOnError"`
 		}
 		var data Schema
 		if err := ctx.BindJSON(&data); err != nil {
 			return
 		}
 
-		result, err := g.ActionPush(data.Transaction)
+		result, err := g.ActionPush(data.Transaction, data.ContinueOnError)
 		if hasError(ctx, err) {
 			return
 		}
-		fmt.Println(result)
 
-		returnSuccess(ctx)
+		ctx.JSON(http.StatusOK, result)
 	})
 
 	r.POST("/api/transformer/add", func(c *gin.Context) {
@@ -105,6 +162,7 @@ func Serve(store *store.Store) {
 			Type        string `json:"type" binding:"required"`
 			Transformer string `json:"transformer" binding:"required"`
 			Content     string `json:"content" binding:"required"`
+			Template    bool   `json:"template"`
 		}
 		var data Schema
 
@@ -113,7 +171,7 @@ func Serve(store *store.Store) {
 			return
 		}
 
-		if err := store.TransformerAdd(data.Transaction, data.Type, data.Transformer, data.Content); err != nil {
+		if err := store.TransformerAdd(data.Transaction, data.Type, data.Transformer, data.Content, data.Template); err != nil {
 			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
 			return
 		}
@@ -148,6 +206,32 @@ func Serve(store *store.Store) {
 			Transaction string `json:"transaction" binding:"required"`
 			Transformer string `json:"transformer" binding:"required"`
 			NewContent  string `json:"newContent" binding:"required"`
+			Template    *bool  `json:"template"`
+		}
+		var data Schema
+
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := store.TransformerEdit(data.Transaction, data.Transformer, data.NewContent, data.Template); err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusOK)
+		return
+	})
+
+	r.POST("/api/transformer/scope", func(c *gin.Context) {
+		type Schema struct {
+			Transaction string   `json:"transaction" binding:"required"`
+			Transformer string   `json:"transformer" binding:"required"`
+			Include     []string `json:"include"`
+			Exclude     []string `json:"exclude"`
+			Repos       []string `json:"repos"`
+			Tags        []string `json:"tags"`
 		}
 		var data Schema
 
@@ -156,7 +240,7 @@ func Serve(store *store.Store) {
 			return
 		}
 
-		if err := store.TransformerEdit(data.Transaction, data.Transformer, data.NewContent); err != nil {
+		if err := store.TransformerScope(data.Transaction, data.Transformer, data.Include, data.Exclude, data.Repos, data.Tags); err != nil {
 			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
 			return
 		}
@@ -167,8 +251,8 @@ func Serve(store *store.Store) {
 
 	r.POST("/api/transformer/order", func(c *gin.Context) {
 		type Schema struct {
-			Transaction string `json:"transaction" binding:"required"`
-			Order       string `json:"order" binding:"required"`
+			Transaction string   `json:"transaction" binding:"required"`
+			Order       []string `json:"order" binding:"required"`
 		}
 		var data Schema
 
@@ -186,10 +270,46 @@ func Serve(store *store.Store) {
 		return
 	})
 
+	r.POST("/api/transformer/move", func(c *gin.Context) {
+		type Schema struct {
+			Transaction string `json:"transaction" binding:"required"`
+			Transformer string `json:"transformer" binding:"required"`
+			Before      string `json:"before"`
+			After       string `json:"after"`
+		}
+		var data Schema
+
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if (data.Before == "") == (data.After == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of 'before' or 'after' must be specified"})
+			return
+		}
+
+		var err error
+		if data.Before != "" {
+			err = store.TransformerMove(data.Transaction, data.Transformer, data.Before, true)
+		} else {
+			err = store.TransformerMove(data.Transaction, data.Transformer, data.After, false)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusOK)
+		return
+	})
+
 	r.POST("/api/repo/add", func(c *gin.Context) {
 		type Schema struct {
 			Transaction string `json:"transaction" binding:"required"`
 			Repo        string `json:"repo" binding:"required"`
+			URL         string `json:"url"`
+			Host        string `json:"host"`
 		}
 		var data Schema
 
@@ -198,7 +318,7 @@ func Serve(store *store.Store) {
 			return
 		}
 
-		if err := store.RepoAdd(data.Transaction, data.Repo); err != nil {
+		if err := store.RepoAdd(data.Transaction, data.Repo, data.URL, data.Host); err != nil {
 			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
 			return
 		}
@@ -210,7 +330,7 @@ func Serve(store *store.Store) {
 	r.POST("/api/repo/remove", func(c *gin.Context) {
 		type Schema struct {
 			Transaction string `json:"transaction" binding:"required"`
-			Repo        string `json: "repo" binding: "required"`
+			Repo        string `json:"repo" binding:"required"`
 		}
 		var data Schema
 
@@ -227,9 +347,90 @@ func Serve(store *store.Store) {
 		return
 	})
 
+	r.POST("/api/repo/tags", func(c *gin.Context) {
+		type Schema struct {
+			Transaction string   `json:"transaction" binding:"required"`
+			Repo        string   `json:"repo" binding:"required"`
+			Tags        []string `json:"tags"`
+		}
+		var data Schema
+
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := store.RepoTags(data.Transaction, data.Repo, data.Tags); err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	})
+
+	r.POST("/api/repo/variables", func(c *gin.Context) {
+		type Schema struct {
+			Transaction string            `json:"transaction" binding:"required"`
+			Repo        string            `json:"repo" binding:"required"`
+			Variables   map[string]string `json:"variables"`
+		}
+		var data Schema
+
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := store.RepoVariables(data.Transaction, data.Repo, data.Variables); err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	})
+
+	r.POST("/api/host/list", func(c *gin.Context) {
+		c.JSON(http.StatusOK, store.HostList())
+	})
+
+	r.POST("/api/host/set", func(c *gin.Context) {
+		var data host
+
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := store.HostSet(data); err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	})
+
+	r.POST("/api/host/remove", func(c *gin.Context) {
+		type Schema struct {
+			Name string `json:"name" binding:"required"`
+		}
+		var data Schema
+
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := store.HostRemove(data.Name); err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	})
+
 	r.POST("/api/transaction/get", func(c *gin.Context) {
 		type Schema struct {
-			Name string `json: "name" binding:"required"`
+			Name string `json:"name" binding:"required"`
 		}
 		var data Schema
 		if err := c.ShouldBindJSON(&data); err != nil {
@@ -248,7 +449,7 @@ func Serve(store *store.Store) {
 
 	r.POST("/api/transaction/add", func(c *gin.Context) {
 		type Schema struct {
-			Name string `json: "name" binding:"required"`
+			Name string `json:"name" binding:"required"`
 		}
 		var data Schema
 		if err := c.ShouldBindJSON(&data); err != nil {
@@ -266,7 +467,7 @@ func Serve(store *store.Store) {
 
 	r.POST("/api/transaction/remove", func(c *gin.Context) {
 		type Schema struct {
-			Name string `json: "name" binding:"required"`
+			Name string `json:"name" binding:"required"`
 		}
 		var data Schema
 		if err := c.ShouldBindJSON(&data); err != nil {
@@ -282,10 +483,37 @@ func Serve(store *store.Store) {
 		c.Status(http.StatusOK)
 	})
 
+	r.POST("/api/transaction/identity", func(c *gin.Context) {
+		type Schema struct {
+			Name       string `json:"name" binding:"required"`
+			CommitName string `json:"commitName"`
+			Email      string `json:"email"`
+			Signing    string `json:"signing"`
+			SigningKey string `json:"signingKey"`
+		}
+		var data Schema
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := store.TransactionIdentity(data.Name, identity{
+			Name:       data.CommitName,
+			Email:      data.Email,
+			Signing:    data.Signing,
+			SigningKey: data.SigningKey,
+		}); err != nil {
+			c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusOK)
+	})
+
 	r.POST("/api/transaction/rename", func(c *gin.Context) {
 		type Schema struct {
-			OldName string `json: "oldName" binding:"required"`
-			NewName string `json: "newName" binding:"required"`
+			OldName string `json:"oldName" binding:"required"`
+			NewName string `json:"newName" binding:"required"`
 		}
 		var data Schema
 		if err := c.ShouldBindJSON(&data); err != nil {
@@ -314,7 +542,7 @@ func Serve(store *store.Store) {
 		return
 	})
 
-	if err := r.Run(":3000"); err != nil {
+	if err := r.Run(config.Address); err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -8,11 +8,16 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
-func New() Store {
+// New reads the store from dataFile, which it is saved to
+func New(dataFile string) Store {
 	store := Store{
 		Transactions: []Transaction{},
+		Hosts:        []Host{},
+		dataFile:     dataFile,
 	}
 	if err := initializeStore(&store); err != nil {
 		log.Fatalln(err)
@@ -23,12 +28,17 @@ func New() Store {
 
 type Store struct {
 	Transactions []Transaction `json:"transactions"`
+	Hosts        []Host        `json:"hosts"`
+	dataFile     string
 }
 
 func (s *Store) TransactionGet(name string) (Transaction, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	for _, t := range s.Transactions {
 		if t.Name == name {
-			return t, nil
+			return t.copy(), nil
 		}
 	}
 
@@ -36,6 +46,9 @@ func (s *Store) TransactionGet(name string) (Transaction, error) {
 }
 
 func (s *Store) TransactionAdd(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	for _, t := range s.Transactions {
 		if t.Name == name {
 			return fmt.Errorf("A transaction with the specified name already exists")
@@ -48,10 +61,13 @@ func (s *Store) TransactionAdd(name string) error {
 		Transformers: []Transformer{},
 	})
 
-	return s.Save()
+	return s.save()
 }
 
 func (s *Store) TransactionRemove(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	idx := -1
 
 	for i, t := range s.Transactions {
@@ -67,10 +83,13 @@ func (s *Store) TransactionRemove(name string) error {
 
 	s.Transactions = append(s.Transactions[:idx], s.Transactions[idx+1:]...)
 
-	return s.Save()
+	return s.save()
 }
 
 func (s *Store) TransactionRename(oldName string, newName string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	success := false
 
 	for i, t := range s.Transactions {
@@ -85,34 +104,136 @@ func (s *Store) TransactionRename(oldName string, newName string) error {
 		return fmt.Errorf("A transaction with the specified name does not exist")
 	}
 
-	return s.Save()
+	return s.save()
 }
 
 func (s *Store) TransactionList() []Transaction {
-	return s.Transactions
+	mu.Lock()
+	defer mu.Unlock()
+
+	transactions := make([]Transaction, 0, len(s.Transactions))
+	for _, t := range s.Transactions {
+		transactions = append(transactions, t.copy())
+	}
+
+	return transactions
 }
 
+// Identity overrides, field by field, the commit identity of the server
 type Transaction struct {
-	Name         string        `json:"name"`
-	Repos        []Repo        `json:"repos"`
-	Transformers []Transformer `json:"transformers"`
+	Name         string         `json:"name"`
+	Repos        []Repo         `json:"repos"`
+	Transformers []Transformer  `json:"transformers"`
+	Identity     CommitIdentity `json:"identity"`
+}
+
+// copy returns a copy of the transaction that shares nothing with it, so that it
+// can be used while the store is changed
+func (t Transaction) copy() Transaction {
+	t.Repos = append([]Repo{}, t.Repos...)
+	for i, repo := range t.Repos {
+		t.Repos[i].Tags = copyStrings(repo.Tags)
+		if repo.Variables != nil {
+			variables := make(map[string]string, len(repo.Variables))
+			for key, value := range repo.Variables {
+				variables[key] = value
+			}
+			t.Repos[i].Variables = variables
+		}
+	}
+
+	t.Transformers = append([]Transformer{}, t.Transformers...)
+	for i, transformer := range t.Transformers {
+		t.Transformers[i].Include = copyStrings(transformer.Include)
+		t.Transformers[i].Exclude = copyStrings(transformer.Exclude)
+		t.Transformers[i].Repos = copyStrings(transformer.Repos)
+		t.Transformers[i].Tags = copyStrings(transformer.Tags)
+	}
+
+	return t
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	return append([]string{}, s...)
+}
+
+// A CommitIdentity is who commits are made by, and how they are signed. Signing is
+// "gpg", "ssh", or "none". Fields that are empty are left to the configuration of
+// git
+type CommitIdentity struct {
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Signing    string `json:"signing"`
+	SigningKey string `json:"signingKey"`
+}
+
+// Validate checks that the identity is usable
+func (c CommitIdentity) Validate() error {
+	if c.Signing != "" && c.Signing != "gpg" && c.Signing != "ssh" && c.Signing != "none" {
+		return fmt.Errorf("Signing must be one of gpg, ssh, or none")
+	}
+
+	if c.Signing == "none" && c.SigningKey != "" {
+		return fmt.Errorf("A signing key cannot be used without signing")
+	}
+
+	return nil
+}
+
+func (s *Store) TransactionIdentity(name string, identity CommitIdentity) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := identity.Validate(); err != nil {
+		return err
+	}
+
+	for i, t := range s.Transactions {
+		if t.Name == name {
+			s.Transactions[i].Identity = identity
+			return s.save()
+		}
+	}
+
+	return fmt.Errorf("A transaction with the specified name does not exist")
 }
 
+// Include and Exclude are file globs that limit which files a transformer may
+// change. Repos (name globs) and Tags select the repositories it runs in. If
+// Template is true, Content is rendered as a text/template for each repository
 type Transformer struct {
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
+	Type     string   `json:"type"`
+	Name     string   `json:"name"`
+	Content  string   `json:"content"`
+	Template bool     `json:"template"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+	Repos    []string `json:"repos"`
+	Tags     []string `json:"tags"`
 }
 
-func (s *Store) TransformerAdd(transactionName string, typ string, name string, content string) error {
+func (s *Store) TransformerAdd(transactionName string, typ string, name string, content string, template bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	found := false
 
 	for i, transaction := range s.Transactions {
 		if transaction.Name == transactionName {
+			// Transformers are referred to by name, so names must be unique
+			if containsTransformer(transaction.Transformers, name) {
+				return fmt.Errorf("A transformer with a name of %s already exists", name)
+			}
+
 			s.Transactions[i].Transformers = append(s.Transactions[i].Transformers, Transformer{
-				Type:    typ,
-				Name:    name,
-				Content: content,
+				Type:     typ,
+				Name:     name,
+				Content:  content,
+				Template: template,
 			})
 			found = true
 		}
@@ -122,10 +243,13 @@ func (s *Store) TransformerAdd(transactionName string, typ string, name string,
 		return fmt.Errorf("Failed to find a transaction with that particular name")
 	}
 
-	return s.Save()
+	return s.save()
 }
 
 func (s *Store) TransformerRemove(transactionName string, transformerName string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	foundTransformer := false
 	foundRepo := false
 
@@ -155,10 +279,15 @@ func (s *Store) TransformerRemove(transactionName string, transformerName string
 		return fmt.Errorf("Failed to find a transaction with that particular name")
 	}
 
-	return s.Save()
+	return s.save()
 }
 
-func (s *Store) TransformerEdit(transactionName string, transformerName string, newContent string) error {
+// TransformerEdit replaces the content of a transformer. If template is not nil,
+// whether the content is a template is changed as well
+func (s *Store) TransformerEdit(transactionName string, transformerName string, newContent string, template *bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	foundTransaction := false
 	foundTransformer := false
 
@@ -169,10 +298,9 @@ func (s *Store) TransformerEdit(transactionName string, transformerName string,
 			for j, transformer := range t.Transformers {
 				if transformer.Name == transformerName {
 					foundTransformer = true
-					s.Transactions[i].Transformers[j] = Transformer{
-						Type:    transformer.Type,
-						Name:    transformer.Name,
-						Content: newContent,
+					s.Transactions[i].Transformers[j].Content = newContent
+					if template != nil {
+						s.Transactions[i].Transformers[j].Template = *template
 					}
 					break
 				}
@@ -188,14 +316,170 @@ func (s *Store) TransformerEdit(transactionName string, transformerName string,
 		return fmt.Errorf("Failed to find a transaction with that particular name")
 	}
 
-	return s.Save()
+	return s.save()
+}
+
+// TransformerScope sets the file globs and repository selectors of a transformer
+func (s *Store) TransformerScope(transactionName string, transformerName string, include []string, exclude []string, repos []string, tags []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	foundTransaction := false
+	foundTransformer := false
+
+	for i, t := range s.Transactions {
+		if t.Name == transactionName {
+			foundTransaction = true
+
+			for j, transformer := range t.Transformers {
+				if transformer.Name == transformerName {
+					foundTransformer = true
+					s.Transactions[i].Transformers[j].Include = include
+					s.Transactions[i].Transformers[j].Exclude = exclude
+					s.Transactions[i].Transformers[j].Repos = repos
+					s.Transactions[i].Transformers[j].Tags = tags
+					break
+				}
+			}
+		}
+	}
+
+	if !foundTransaction {
+		return fmt.Errorf("Failed to find a transaction with that particular name")
+	}
+
+	if !foundTransformer {
+		return fmt.Errorf("Failed to find a transformer with that particular name")
+	}
+
+	return s.save()
+}
+
+// TransformerOrder sets the order in which the transformers of a transaction run.
+// The order must name every transformer exactly once
+func (s *Store) TransformerOrder(transactionName string, order []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.transformerOrder(transactionName, order)
+}
+
+func (s *Store) transformerOrder(transactionName string, order []string) error {
+	for i, t := range s.Transactions {
+		if t.Name == transactionName {
+			// Stores saved before names had to be unique may still have duplicates,
+			// which cannot be told apart
+			byName := map[string]Transformer{}
+			for _, transformer := range t.Transformers {
+				if _, ok := byName[transformer.Name]; ok {
+					return fmt.Errorf("Transaction has more than one transformer with a name of %s", transformer.Name)
+				}
+				byName[transformer.Name] = transformer
+			}
+
+			newTransformers := []Transformer{}
+			for _, name := range order {
+				transformer, ok := byName[name]
+				if !ok {
+					if containsTransformer(newTransformers, name) {
+						return fmt.Errorf("Transformer '%s' is specified more than once", name)
+					}
+
+					return fmt.Errorf("Failed to find a transformer with a name of %s", name)
+				}
+
+				newTransformers = append(newTransformers, transformer)
+				delete(byName, name)
+			}
+
+			if len(byName) > 0 {
+				missing := []string{}
+				for _, transformer := range t.Transformers {
+					if _, ok := byName[transformer.Name]; ok {
+						missing = append(missing, transformer.Name)
+					}
+				}
+
+				return fmt.Errorf("Order is missing transformers: %s", strings.Join(missing, ", "))
+			}
+
+			s.Transactions[i].Transformers = newTransformers
+			return s.save()
+		}
+	}
+
+	return fmt.Errorf("Failed to find a transaction with that particular name")
 }
 
-func (s *Store) TransformerOrder(transformerName string, transformer string) error {
-	return s.Save()
+// TransformerMove moves a transformer so that it runs directly before (or if before
+// is false, after) another transformer
+func (s *Store) TransformerMove(transactionName string, transformerName string, targetName string, before bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if transformerName == targetName {
+		return fmt.Errorf("Cannot move a transformer relative to itself")
+	}
+
+	for _, t := range s.Transactions {
+		if t.Name == transactionName {
+			if !containsTransformer(t.Transformers, transformerName) {
+				return fmt.Errorf("Failed to find a transformer with a name of %s", transformerName)
+			}
+
+			if !containsTransformer(t.Transformers, targetName) {
+				return fmt.Errorf("Failed to find a transformer with a name of %s", targetName)
+			}
+
+			order := []string{}
+			for _, transformer := range t.Transformers {
+				if transformer.Name == transformerName {
+					continue
+				}
+
+				if transformer.Name == targetName && before {
+					order = append(order, transformerName, targetName)
+				} else if transformer.Name == targetName {
+					order = append(order, targetName, transformerName)
+				} else {
+					order = append(order, transformer.Name)
+				}
+			}
+
+			return s.transformerOrder(transactionName, order)
+		}
+	}
+
+	return fmt.Errorf("Failed to find a transaction with that particular name")
+}
+
+func containsTransformer(transformers []Transformer, name string) bool {
+	for _, transformer := range transformers {
+		if transformer.Name == name {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (s *Store) RepoAdd(transactionName string, repoName string) error {
+// RepoAdd adds a repository to a transaction. It is cloned from url if it is set
+// (a URL, or a local path), and otherwise from the host with a name of host (by
+// default, "github")
+func (s *Store) RepoAdd(transactionName string, repoName string, url string, host string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if url != "" && host != "" {
+		return fmt.Errorf("A repo can have either a URL or a host, not both")
+	}
+
+	if host != "" {
+		if _, err := s.hostGet(host); err != nil {
+			return err
+		}
+	}
+
 	found := false
 
 	for i, t := range s.Transactions {
@@ -203,7 +487,9 @@ func (s *Store) RepoAdd(transactionName string, repoName string) error {
 			found = true
 			s.Transactions[i].Repos = append(s.Transactions[i].Repos, Repo{
 				Name:   repoName,
-				Status: "uninitialized",
+				URL:    url,
+				Host:   host,
+				Status: StatusUninitialized,
 			})
 		}
 	}
@@ -212,10 +498,13 @@ func (s *Store) RepoAdd(transactionName string, repoName string) error {
 		return fmt.Errorf("Failed to find a transaction with that particular name")
 	}
 
-	return s.Save()
+	return s.save()
 }
 
 func (s *Store) RepoRemove(transactionName string, repoName string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	foundTransaction := false
 	foundRepo := false
 
@@ -245,19 +534,241 @@ func (s *Store) RepoRemove(transactionName string, repoName string) error {
 		return fmt.Errorf("Failed to find a transaction with that particular name")
 	}
 
-	return s.Save()
+	return s.save()
+}
+
+func (s *Store) RepoTags(transactionName string, repoName string, tags []string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	foundTransaction := false
+	foundRepo := false
+
+	for i, t := range s.Transactions {
+		if t.Name == transactionName {
+			foundTransaction = true
+
+			for j, repo := range t.Repos {
+				if repo.Name == repoName {
+					foundRepo = true
+					s.Transactions[i].Repos[j].Tags = tags
+				}
+			}
+		}
+	}
+
+	if !foundTransaction {
+		return fmt.Errorf("Failed to find a transaction with that particular name")
+	}
+
+	if !foundRepo {
+		return fmt.Errorf("Failed to find a repo with that particular name")
+	}
+
+	return s.save()
+}
+
+func (s *Store) RepoVariables(transactionName string, repoName string, variables map[string]string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	foundTransaction := false
+	foundRepo := false
+
+	for i, t := range s.Transactions {
+		if t.Name == transactionName {
+			foundTransaction = true
+
+			for j, repo := range t.Repos {
+				if repo.Name == repoName {
+					foundRepo = true
+					s.Transactions[i].Repos[j].Variables = variables
+				}
+			}
+		}
+	}
+
+	if !foundTransaction {
+		return fmt.Errorf("Failed to find a transaction with that particular name")
+	}
+
+	if !foundRepo {
+		return fmt.Errorf("Failed to find a repo with that particular name")
+	}
+
+	return s.save()
+}
+
+// RepoUpdate changes a repository with update, and saves the store
+func (s *Store) RepoUpdate(transactionName string, repoName string, update func(repo *Repo)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, t := range s.Transactions {
+		if t.Name != transactionName {
+			continue
+		}
+
+		for j, repo := range t.Repos {
+			if repo.Name == repoName {
+				update(&s.Transactions[i].Repos[j])
+				return s.save()
+			}
+		}
+
+		return fmt.Errorf("Failed to find a repo with that particular name")
+	}
+
+	return fmt.Errorf("Failed to find a transaction with that particular name")
 }
 
+// The lifecycle of a repository. It is "dirty" when transformers have changed it,
+// and "failed" when the last action failed in it (Error is then set)
+const (
+	StatusUninitialized = "uninitialized"
+	StatusCloning       = "cloning"
+	StatusCloned        = "cloned"
+	StatusDirty         = "dirty"
+	StatusCommitted     = "committed"
+	StatusPushed        = "pushed"
+	StatusFailed        = "failed"
+)
+
+// Variables are available to templated transformers, along with built-in values
+// like the name and default branch of the repository
 type Repo struct {
-	Name   string `json:"name"`
-	URL    string `json:"url"`
-	Dir    string `json:"dir"`
-	Status string `json:"status"`
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	Host      string            `json:"host,omitempty"`
+	Dir       string            `json:"dir"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	Tags      []string          `json:"tags"`
+	Variables map[string]string `json:"variables"`
+}
+
+// A Host is a git host that repositories are cloned from, by their name. Protocol
+// is "ssh" or "https". User (by default, "git") only applies to SSH, and
+// CredentialHelper only applies to HTTPS
+type Host struct {
+	Name             string `json:"name"`
+	Domain           string `json:"domain"`
+	Protocol         string `json:"protocol"`
+	User             string `json:"user,omitempty"`
+	Port             int    `json:"port,omitempty"`
+	CredentialHelper string `json:"credentialHelper,omitempty"`
+}
+
+// defaultHosts are available without being added. Adding a host with the same name
+// replaces one
+var defaultHosts = []Host{
+	{Name: "github", Domain: "github.com", Protocol: "ssh"},
+	{Name: "gitlab", Domain: "gitlab.com", Protocol: "ssh"},
+}
+
+func (s *Store) HostGet(name string) (Host, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.hostGet(name)
+}
+
+func (s *Store) hostGet(name string) (Host, error) {
+	for _, h := range s.hostList() {
+		if h.Name == name {
+			return h, nil
+		}
+	}
+
+	return Host{}, fmt.Errorf("A host with the specified name does not exist")
+}
+
+// HostList returns the hosts that were added, followed by the default hosts that
+// were not replaced
+func (s *Store) HostList() []Host {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.hostList()
+}
+
+func (s *Store) hostList() []Host {
+	hosts := append([]Host{}, s.Hosts...)
+	for _, d := range defaultHosts {
+		replaced := false
+		for _, h := range s.Hosts {
+			if h.Name == d.Name {
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			hosts = append(hosts, d)
+		}
+	}
+
+	return hosts
+}
+
+// HostSet adds a host, or replaces the host with the same name
+func (s *Store) HostSet(host Host) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if host.Name == "" || host.Domain == "" {
+		return fmt.Errorf("A host must have a name and a domain")
+	}
+
+	if host.Protocol == "" {
+		host.Protocol = "ssh"
+	}
+	if host.Protocol != "ssh" && host.Protocol != "https" {
+		return fmt.Errorf("Protocol of a host must be either ssh or https")
+	}
+
+	for i, h := range s.Hosts {
+		if h.Name == host.Name {
+			s.Hosts[i] = host
+			return s.save()
+		}
+	}
+
+	s.Hosts = append(s.Hosts, host)
+
+	return s.save()
 }
 
+func (s *Store) HostRemove(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, h := range s.Hosts {
+		if h.Name == name {
+			s.Hosts = append(s.Hosts[:i], s.Hosts[i+1:]...)
+			return s.save()
+		}
+	}
+
+	return fmt.Errorf("A host with the specified name was not added")
+}
+
+// mu is held while the store is read, changed, or saved, since actions change
+// repositories concurrently with each other (and with HTTP handlers)
+var mu sync.Mutex
+
 func (s *Store) Save() error {
-	home := os.Getenv("HOME")
-	repoFile := filepath.Join(home, ".config", "redpanda", "data.json")
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.save()
+}
+
+func (s *Store) save() error {
+	if s.dataFile == "" {
+		return fmt.Errorf("Failed to save the store, since it has no data file")
+	}
+
+	repoFile := s.dataFile
 	err := os.MkdirAll(filepath.Dir(repoFile), 0o755)
 	if err != nil {
 		return err
@@ -276,9 +787,7 @@ func (s *Store) Save() error {
 }
 
 func initializeStore(store *Store) error {
-	home := os.Getenv("HOME") // TODO
-	dataFile := filepath.Join(home, ".config", "redpanda", "data.json")
-	content, err := ioutil.ReadFile(dataFile)
+	content, err := ioutil.ReadFile(store.dataFile)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil
@@ -291,5 +800,16 @@ func initializeStore(store *Store) error {
 	if err != nil {
 		return err
 	}
+
+	// Before the lifecycle of repositories was tracked, cloned repositories were
+	// "initialized"
+	for i := range store.Transactions {
+		for j, repo := range store.Transactions[i].Repos {
+			if repo.Status == "initialized" {
+				store.Transactions[i].Repos[j].Status = StatusCloned
+			}
+		}
+	}
+
 	return nil
 }